@@ -1,13 +1,30 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"os"
+
 	"github.com/AlexCorn999/short-url-service/internal/app/apiserver"
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
 	config := apiserver.NewConfig()
-	config.ParseFlags()
+	if err := config.ParseFlags(); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatal(err)
+	}
+
+	if config.PrintConfig {
+		if err := config.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	server := apiserver.New(config)
 
 	if err := server.Start(); err != nil {
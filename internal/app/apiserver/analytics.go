@@ -0,0 +1,91 @@
+package apiserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	"github.com/go-chi/chi"
+)
+
+// recordClick ставит переход по ссылке в очередь для статистики.
+func (s *APIServer) recordClick(r *http.Request, code string) {
+	if s.clicks == nil {
+		return
+	}
+
+	s.clicks.Push(store.Click{
+		Code:      code,
+		Time:      time.Now().UTC(),
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IPHash:    hashIP(clientIP(r), s.config.AnalyticsSalt),
+	})
+}
+
+// clientIP возвращает адрес клиента без порта.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// hashIP хеширует адрес клиента, чтобы не хранить его в открытом виде.
+func hashIP(ip, salt string) string {
+	sum := sha256.Sum256([]byte(salt + ip))
+	return hex.EncodeToString(sum[:])
+}
+
+// URLStats возвращает статистику переходов по ссылке. Доступна только её создателю.
+func (s *APIServer) URLStats(w http.ResponseWriter, r *http.Request) {
+	creator, err := sessionUserID(r)
+	if err != nil {
+		s.writeError(w, r, userError(err))
+		return
+	}
+
+	code := chi.URLParam(r, "id")
+
+	ctx, cancel := s.dbContext(r)
+	defer cancel()
+
+	// статистика доступна и для удалённых или просроченных ссылок
+	var url store.URL
+	if err := s.Database.ReadURL(ctx, &url, code); err != nil && !errors.Is(err, store.ErrDeleted) && !errors.Is(err, store.ErrExpired) {
+		if errors.Is(err, store.ErrNotFound) {
+			s.writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound, "short url not found"))
+			return
+		}
+		s.writeError(w, r, storageError(err))
+		return
+	}
+
+	// чужие ссылки не раскрываются
+	if url.Creator != creator {
+		s.writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound, "short url not found"))
+		return
+	}
+
+	stats, err := s.analytics.ClickStats(ctx, code)
+	if err != nil {
+		s.writeError(w, r, storageError(err))
+		return
+	}
+
+	objectJSON, err := json.Marshal(stats)
+	if err != nil {
+		s.writeError(w, r, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(objectJSON)
+}
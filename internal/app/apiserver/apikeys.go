@@ -0,0 +1,214 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/auth"
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	"github.com/go-chi/chi"
+)
+
+// максимальная длина названия ключа
+const maxAPIKeyNameLength = 64
+
+// запрос на создание ключа для JSON объекта
+type createAPIKey struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// ключ для JSON ответа, сам ключ возвращается только при создании
+type apiKeyResult struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key,omitempty"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newAPIKeyResult(key store.APIKey) apiKeyResult {
+	return apiKeyResult{
+		ID:        key.ID,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+}
+
+// bearerKey возвращает API ключ из заголовка Authorization.
+// Если заголовка нет, ok равно false.
+func bearerKey(r *http.Request) (key string, ok bool, err error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", false, nil
+	}
+
+	scheme, key, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(key) == "" {
+		return "", true, errors.New("authorization header must be Bearer <key>")
+	}
+	return strings.TrimSpace(key), true, nil
+}
+
+// requireScope пропускает запрос, если API ключ разрешает область scope.
+// Запросы с токеном из cookie не ограничены.
+func (s *APIServer) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !auth.HasScope(r.Context(), scope) {
+				s.writeError(w, r, newAPIError(http.StatusForbidden, codeForbidden, "api key scope does not allow %s", scope).
+					withDetail("scope", scope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireSession пропускает только запросы с токеном из cookie,
+// чтобы ключом нельзя было выпустить новые ключи или войти под другим пользователем.
+func (s *APIServer) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.IsAPIKey(r.Context()) {
+			s.writeError(w, r, newAPIError(http.StatusForbidden, codeForbidden, "api keys are not allowed here"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CreateAPIKey создаёт API ключ текущего пользователя.
+// Принимает JSON-объект {"name":"<name>","scopes":["read","shorten","delete"]},
+// пустой список scopes означает ключ без ограничений.
+func (s *APIServer) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	creator, err := auth.UserID(r.Context())
+	if err != nil {
+		s.writeError(w, r, userError(err))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, r, bodyError(err))
+		return
+	}
+
+	var request createAPIKey
+	if len(body) != 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			s.writeError(w, r, jsonError(err))
+			return
+		}
+	}
+	if len(request.Name) > maxAPIKeyNameLength {
+		s.writeError(w, r, badRequestError("name is too long"))
+		return
+	}
+
+	scopes, err := auth.ValidateScopes(request.Scopes)
+	if err != nil {
+		s.writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidScope, "%s", err))
+		return
+	}
+
+	id, secret, err := auth.NewAPIKey()
+	if err != nil {
+		s.writeError(w, r, internalError(err))
+		return
+	}
+
+	key := store.APIKey{
+		ID:        id,
+		UserID:    creator,
+		Name:      request.Name,
+		Hash:      auth.HashAPIKey(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	ctx, cancel := s.dbContext(r)
+	defer cancel()
+
+	if err := s.apiKeys.CreateAPIKey(ctx, &key); err != nil {
+		s.writeError(w, r, storageError(err))
+		return
+	}
+
+	result := newAPIKeyResult(key)
+	result.Key = secret
+	objectJSON, err := json.Marshal(result)
+	if err != nil {
+		s.writeError(w, r, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(objectJSON)
+}
+
+// ListAPIKeys возвращает API ключи текущего пользователя без самих ключей.
+func (s *APIServer) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	creator, err := sessionUserID(r)
+	if err != nil {
+		s.writeError(w, r, userError(err))
+		return
+	}
+
+	ctx, cancel := s.dbContext(r)
+	defer cancel()
+
+	keys, err := s.apiKeys.ListAPIKeys(ctx, creator)
+	if err != nil {
+		s.writeError(w, r, storageError(err))
+		return
+	}
+
+	if len(keys) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	result := make([]apiKeyResult, len(keys))
+	for i, key := range keys {
+		result[i] = newAPIKeyResult(key)
+	}
+
+	objectJSON, err := json.Marshal(result)
+	if err != nil {
+		s.writeError(w, r, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(objectJSON)
+}
+
+// RevokeAPIKey отзывает API ключ текущего пользователя.
+func (s *APIServer) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	creator, err := sessionUserID(r)
+	if err != nil {
+		s.writeError(w, r, userError(err))
+		return
+	}
+
+	ctx, cancel := s.dbContext(r)
+	defer cancel()
+
+	if err := s.apiKeys.RevokeAPIKey(ctx, creator, chi.URLParam(r, "id")); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			s.writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound, "api key not found"))
+			return
+		}
+		s.writeError(w, r, storageError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,36 +2,50 @@ package apiserver
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"strconv"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/AlexCorn999/short-url-service/internal/app/auth"
+	"github.com/AlexCorn999/short-url-service/internal/app/codegen"
 	"github.com/AlexCorn999/short-url-service/internal/app/filestorage"
 	"github.com/AlexCorn999/short-url-service/internal/app/gzip"
 	"github.com/AlexCorn999/short-url-service/internal/app/logger"
 	"github.com/AlexCorn999/short-url-service/internal/app/memorystorage"
+	"github.com/AlexCorn999/short-url-service/internal/app/metrics"
+	"github.com/AlexCorn999/short-url-service/internal/app/policy"
+	"github.com/AlexCorn999/short-url-service/internal/app/ratelimit"
+	"github.com/AlexCorn999/short-url-service/internal/app/requestid"
 	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	"github.com/AlexCorn999/short-url-service/internal/app/tracing"
+	"github.com/AlexCorn999/short-url-service/internal/app/urlnorm"
 	"github.com/AlexCorn999/short-url-service/internal/app/worker"
 	"github.com/go-chi/chi"
 
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var (
-	authForFlag = false
-	authString  string
-	tknStr      string
-)
+// срок жизни ссылки для JSON объекта: expires_in в секундах или expires_at в RFC 3339
+type expiration struct {
+	ExpiresIn int64      `json:"expires_in,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
 
 type batchURL struct {
 	CorrelationID string `json:"correlation_id"`
 	OriginalURL   string `json:"original_url"`
-	shortURL      string
+	expiration
+	shortURL string
 }
 
 type resultBatchURL struct {
@@ -41,7 +55,9 @@ type resultBatchURL struct {
 
 // URL для JSON объекта
 type shortenURL struct {
-	URL string `json:"url"`
+	URL   string `json:"url"`
+	Alias string `json:"alias,omitempty"`
+	expiration
 }
 
 // URL для JSON объекта
@@ -49,12 +65,50 @@ type URLResult struct {
 	ResultURL string `json:"result"`
 }
 
+var errInvalidExpiration = errors.New("invalid expiration")
+
+// deadline возвращает момент истечения ссылки или нулевое время для бессрочной.
+func (e expiration) deadline(now time.Time) (time.Time, error) {
+	switch {
+	case e.ExpiresIn != 0 && e.ExpiresAt != nil:
+		return time.Time{}, fmt.Errorf("%w: expires_in and expires_at are mutually exclusive", errInvalidExpiration)
+	case e.ExpiresIn < 0:
+		return time.Time{}, fmt.Errorf("%w: expires_in must be positive", errInvalidExpiration)
+	case e.ExpiresIn > 0:
+		return now.Add(time.Duration(e.ExpiresIn) * time.Second), nil
+	case e.ExpiresAt != nil:
+		if !e.ExpiresAt.After(now) {
+			return time.Time{}, fmt.Errorf("%w: expires_at must be in the future", errInvalidExpiration)
+		}
+		return *e.ExpiresAt, nil
+	}
+	return time.Time{}, nil
+}
+
 // APIServer ...
 type APIServer struct {
 	store.Database
+	analytics   store.Analytics
 	initialized bool
 	typeStore   string
+	keys        *auth.Keyring
+	users       store.UserIDAllocator
+	accounts    store.Accounts
+	apiKeys     store.APIKeys
+	limiter     ratelimit.Limiter
+	limits      map[string]ratelimit.Limit
+	codes       codegen.Generator
+	aliases     codegen.AliasRules
+	urls        *urlnorm.Normalizer
+	policy      policy.URLPolicy
+	blocklist   *policy.Blocklist
 	worker      *worker.DeleteURLQueue
+	clicks      *worker.ClickQueue
+	reaper      *worker.ExpiredURLReaper
+	metrics     *metrics.Metrics
+	tracer      trace.TracerProvider
+	// отправляет оставшиеся спаны при остановке
+	stopTracing func(context.Context) error
 	logger      *log.Logger
 	config      *Config
 	router      *chi.Mux
@@ -71,46 +125,231 @@ func New(config *Config) *APIServer {
 }
 
 // Start APIServer
+// Сервер работает до получения SIGINT или SIGTERM.
 func (s *APIServer) Start() error {
+	s.configureMetrics()
+
+	if err := s.configureTracing(); err != nil {
+		return err
+	}
+
 	s.configureRouter()
 
 	if err := s.configureLogger(); err != nil {
 		return err
 	}
 
+	if err := s.configureAuth(); err != nil {
+		return err
+	}
+
 	if err := s.configureStore(); err != nil {
 		return err
 	}
 
-	if s.typeStore == "database" {
-		defer s.Database.Close()
-	} else if s.typeStore == "file" {
-		defer s.Database.Close()
+	if err := s.configureRateLimit(); err != nil {
+		return err
+	}
+
+	if err := s.configurePolicy(); err != nil {
+		return err
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return s.Run(ctx)
+}
+
+// Run обслуживает запросы до отмены ctx, затем корректно останавливает сервер.
+// Хранилище должно быть уже настроено.
+func (s *APIServer) Run(ctx context.Context) error {
+	workerCtx, cancelWorkers := context.WithCancel(context.Background())
+	defer cancelWorkers()
+
 	// для асинхронного удаления.
-	worker := worker.NewDeleteURLQueue(s.Database, s.logger, 5)
-	s.worker = worker
-	s.worker.Start(context.Background())
+	s.worker = worker.NewDeleteURLQueue(s.Database, s.logger, 5)
+	s.worker.SetInterval(s.config.WorkerBatchInterval)
+	if s.metrics != nil {
+		s.worker.SetObserver(s.metrics)
+	}
+	s.worker.Start(workerCtx)
+
+	// для очистки просроченных ссылок.
+	s.reaper = worker.NewExpiredURLReaper(s.Database, s.logger, s.config.ReapInterval)
+	if limits, ok := s.limiter.(worker.RateLimitStore); ok {
+		s.reaper.SetRateLimits(limits, s.rateLimitRefill())
+	}
+	s.reaper.Start(workerCtx)
+
+	// для асинхронной записи статистики переходов.
+	s.clicks = worker.NewClickQueue(s.analytics, s.logger, 1000)
+	s.clicks.SetInterval(s.config.WorkerBatchInterval)
+	s.clicks.Start(workerCtx)
+
+	// для перечитывания блок-листа при изменении.
+	if s.blocklist != nil {
+		s.blocklist.Watch(workerCtx, s.config.URLBlocklistReload)
+	}
+
+	srv := &http.Server{
+		Addr:    s.config.bindAddr,
+		Handler: s.handler(),
+	}
 
 	s.logger.Info("starting api server")
 
-	return http.ListenAndServe(s.config.bindAddr, s.router)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+		s.logger.Error(err)
+	case <-ctx.Done():
+		s.logger.Info("shutting down api server")
+	}
+
+	if shutdownErr := s.shutdown(srv, cancelWorkers); err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+// shutdown перестаёт принимать соединения, дожидается завершения запросов,
+// сохраняет задачи из очередей, останавливает фоновые задачи и закрывает хранилище.
+// На всю остановку отводится ShutdownTimeout.
+func (s *APIServer) shutdown(srv *http.Server, cancelWorkers context.CancelFunc) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("http server shutdown - %w", err))
+	}
+
+	// очереди останавливаются только после завершения обработчиков,
+	// чтобы новые задачи не попали в них после сохранения
+	cancelWorkers()
+	if err := s.worker.Wait(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.clicks.Wait(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	// очистка и перечитывание блок-листа не должны застать хранилище закрытым
+	if err := s.reaper.Wait(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if s.blocklist != nil {
+		if err := s.blocklist.Wait(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := s.Database.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("storage close - %w", err))
+	}
+
+	if s.stopTracing != nil {
+		if err := s.stopTracing(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("tracing shutdown - %w", err))
+		}
+	}
+
+	for _, err := range errs {
+		s.logger.Error(err)
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+
+	s.logger.Info("api server stopped")
+	return nil
 }
 
 func (s *APIServer) configureRouter() {
 	s.router = chi.NewRouter()
-	s.router.Use(s.Auth)
-	s.router.Use(logger.WithLogging)
-	s.router.Use(gzip.GzipHandle)
-	s.router.Post("/api/shorten/batch", s.BatchURL)
-	s.router.Post("/api/shorten", s.ShortenURL)
-	s.router.Post("/", s.StringAccept)
-	s.router.Get("/{id}", s.StringBack)
-	s.router.Get("/ping", s.Ping)
-	s.router.Get("/api/user/urls", s.GetAllURL)
-	s.router.Delete("/api/user/urls", s.DeleteURL)
-	s.router.NotFound(badRequest)
+	s.router.Use(tracing.Middleware(s.tracer))
+	s.router.Use(s.metrics.Middleware)
+	s.router.Use(requestid.Middleware)
+	s.router.Use(tracing.Span(s.tracer, "Auth", s.Auth))
+	s.router.Use(tracing.Span(s.tracer, "WithLogging", logger.New(s.logger, s.config.LogRedirectSample).WithLogging))
+	s.router.Use(tracing.Span(s.tracer, "GzipHandle", gzip.GzipHandle))
+	s.router.Use(s.limitBody)
+
+	// с префиксом в base_url все маршруты обслуживаются под ним
+	if prefix := s.config.BaseURL.Prefix(); prefix != "" {
+		s.router.Route(prefix, s.routes)
+	} else {
+		s.routes(s.router)
+	}
+	s.router.NotFound(s.badRequest)
+}
+
+// routes регистрирует маршруты API в r.
+func (s *APIServer) routes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(s.rateLimit(ratelimit.GroupCreate), s.requireScope(auth.ScopeShorten))
+		r.Post("/api/shorten/batch", s.BatchURL)
+		r.Post("/api/shorten", s.ShortenURL)
+		r.Post("/", s.StringAccept)
+	})
+	r.With(s.rateLimit(ratelimit.GroupRedirect)).Get("/{id}", s.StringBack)
+	r.Get("/ping", s.Ping)
+	r.Get("/api/openapi.json", s.OpenAPI)
+	r.With(s.requireSession).Post("/api/user/register", s.Register)
+	r.With(s.requireSession).Post("/api/user/login", s.Login)
+	r.With(s.requireScope(auth.ScopeRead)).Get("/api/user/urls", s.GetAllURL)
+	r.With(s.requireScope(auth.ScopeRead)).Get("/api/user/urls/{id}/stats", s.URLStats)
+	r.With(s.rateLimit(ratelimit.GroupDelete), s.requireScope(auth.ScopeDelete)).Delete("/api/user/urls", s.DeleteURL)
+	r.With(s.requireSession).Post("/api/user/keys", s.CreateAPIKey)
+	r.With(s.requireSession).Get("/api/user/keys", s.ListAPIKeys)
+	r.With(s.requireSession).Delete("/api/user/keys/{id}", s.RevokeAPIKey)
+}
+
+// configureMetrics создаёт метрики, если они включены.
+// Вызывается до configureRouter и configureStore, которые их подключают.
+func (s *APIServer) configureMetrics() {
+	if s.config.MetricsEnabled {
+		s.metrics = metrics.New()
+	}
+}
+
+// configureTracing создаёт провайдер трассировки, если задан экспортёр.
+// Вызывается до configureRouter и configureStore, которые его подключают.
+func (s *APIServer) configureTracing() error {
+	tp, shutdown, err := tracing.Setup(tracing.Options{
+		Exporter:    s.config.TracingExporter,
+		Endpoint:    s.config.TracingEndpoint,
+		ServiceName: s.config.ServiceName,
+		SampleRatio: s.config.TracingSampleRatio,
+	})
+	if err != nil {
+		return err
+	}
+	if tp == nil {
+		return nil
+	}
+
+	s.tracer = tp
+	s.stopTracing = shutdown
+	s.logger.AddHook(tracing.LogHook{})
+	return nil
+}
+
+// handler возвращает обработчик сервера: роутер API и /metrics.
+// Метрики отдаются мимо роутера, чтобы опрос не создавал пользователей в Auth.
+func (s *APIServer) handler() http.Handler {
+	if s.metrics == nil {
+		return s.router
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.metrics.Handler())
+	mux.Handle("/", s.router)
+	return mux
 }
 
 func (s *APIServer) configureLogger() error {
@@ -119,6 +358,76 @@ func (s *APIServer) configureLogger() error {
 		return err
 	}
 	s.logger.SetLevel(level)
+
+	formatter, err := logger.NewFormatter(s.config.LogFormat)
+	if err != nil {
+		return err
+	}
+	s.logger.SetFormatter(formatter)
+	return nil
+}
+
+// configureAuth загружает ключи подписи токенов.
+// Без заданного секрета HS256 ключ генерируется случайно, и токены
+// перестают действовать после перезапуска.
+func (s *APIServer) configureAuth() error {
+	secret := []byte(s.config.JWTSecret)
+	if s.config.JWTSecretFile != "" {
+		data, err := os.ReadFile(s.config.JWTSecretFile)
+		if err != nil {
+			return fmt.Errorf("error from auth. can't read key file - %w", err)
+		}
+		secret = data
+	}
+
+	if len(secret) == 0 {
+		if s.config.JWTAlgorithm != auth.AlgHS256 {
+			return fmt.Errorf("error from auth. %s requires a key file", s.config.JWTAlgorithm)
+		}
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return fmt.Errorf("error from auth. can't generate secret - %w", err)
+		}
+		secret = []byte(hex.EncodeToString(random))
+		// ссылки в файле или базе данных переживут перезапуск, а их владельцы нет
+		if s.config.FilePath != "" || s.config.databaseAddr != "" {
+			s.logger.Warn("JWT secret is not set with persistent storage, users will lose their links after a restart")
+		} else {
+			s.logger.Warn("JWT secret is not set, tokens will not survive a restart")
+		}
+	}
+
+	active, err := auth.LoadKey(s.config.JWTKeyID, s.config.JWTAlgorithm, secret)
+	if err != nil {
+		return err
+	}
+
+	// предыдущие ключи в виде kid:alg:path
+	var previous []*auth.Key
+	for _, entry := range s.config.JWTPreviousKeys {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return fmt.Errorf("error from auth. previous key must be kid:alg:path, got %q", entry)
+		}
+		data, err := os.ReadFile(parts[2])
+		if err != nil {
+			return fmt.Errorf("error from auth. can't read key file - %w", err)
+		}
+		key, err := auth.LoadKey(parts[0], parts[1], data)
+		if err != nil {
+			return err
+		}
+		previous = append(previous, key)
+	}
+
+	keys, err := auth.NewKeyring(auth.Options{
+		TokenExp:      s.config.TokenExp,
+		RefreshBefore: s.config.TokenRefreshBefore,
+	}, active, previous...)
+	if err != nil {
+		return err
+	}
+	s.keys = keys
 	return nil
 }
 
@@ -131,138 +440,208 @@ func (s *APIServer) configureStore() error {
 			return err
 		}
 		s.Database = db
+		s.analytics = db
+		s.users = db
+		s.accounts = db
+		s.apiKeys = db
 		s.typeStore = "database"
 
-		// переписываем значение из базы для user_id
-		newIDForDB, err := s.Database.InitID()
-		if err != nil {
-			return err
-		}
-		auth.ChangeID(newIDForDB)
-
 	} else if len(strings.TrimSpace(s.config.FilePath)) != 0 {
 		db, err := filestorage.NewBoltDB(s.config.FilePath)
 		if err != nil {
 			return err
 		}
 		s.Database = db
+		s.analytics = db
+		s.users = db
+		s.accounts = db
+		s.apiKeys = db
 		s.typeStore = "file"
 	} else {
 		db := memorystorage.NewMemoryStorage()
 		s.Database = db
+		s.analytics = db
+		s.users = db
+		s.accounts = db
+		s.apiKeys = db
 		s.typeStore = "local"
 	}
+	s.Database = metrics.WrapDatabase(s.Database, s.typeStore, s.metrics)
+	s.Database = tracing.WrapDatabase(s.Database, s.typeStore, s.tracer)
+
+	codes, err := codegen.New(codegen.Options{
+		Strategy: s.config.CodeGenerator,
+		Length:   s.config.CodeLength,
+		Salt:     s.config.CodeSalt,
+		Reserved: s.config.ReservedCodes,
+	}, s.Database)
+	if err != nil {
+		return err
+	}
+	s.codes = codes
+	s.aliases = codegen.AliasRules{
+		Charset:   s.config.AliasCharset,
+		MinLength: s.config.AliasMinLen,
+		MaxLength: s.config.AliasMaxLen,
+		Reserved:  s.config.ReservedCodes,
+	}
+
+	urls, err := urlnorm.New(urlnorm.Options{
+		AllowedSchemes: s.config.URLAllowedSchemes,
+		DefaultScheme:  s.config.URLDefaultScheme,
+		MaxLength:      s.config.URLMaxLength,
+	})
+	if err != nil {
+		return err
+	}
+	s.urls = urls
 
 	return nil
 }
 
+// limitBody ограничивает размер тела запроса после распаковки,
+// чтение большего тела возвращает *http.MaxBytesError.
+func (s *APIServer) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.MaxBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxBodySize)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // badRequest задает ошибку 400 по умолчанию на неизвестные запросы
-func badRequest(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusBadRequest)
+func (s *APIServer) badRequest(w http.ResponseWriter, r *http.Request) {
+	s.writeError(w, r, badRequestError("unknown request %s %s", r.Method, r.URL.Path))
+}
+
+// shortLink возвращает сокращённую ссылку для кода.
+// С заданным base_url используется он, иначе хост запроса.
+func (s *APIServer) shortLink(r *http.Request, code string) string {
+	if s.config.BaseURL.IsZero() {
+		return requestBaseURL(r).Link(code)
+	}
+	return s.config.BaseURL.Link(code)
+}
+
+// dbContext возвращает контекст запроса с таймаутом на обращение к хранилищу.
+func (s *APIServer) dbContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if s.config.DBTimeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), s.config.DBTimeout)
+}
+
+// maxGenerateAttempts число попыток записи под сгенерированным кодом.
+const maxGenerateAttempts = 3
+
+// writeGenerated сохраняет url под сгенерированным кодом. Генератор проверяет,
+// что код свободен, но до записи его может занять другой запрос,
+// тогда код генерируется заново.
+func (s *APIServer) writeGenerated(ctx context.Context, url *store.URL) error {
+	var err error
+	for i := 0; i < maxGenerateAttempts; i++ {
+		url.Code, err = s.codes.Generate(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = s.Database.WriteURL(ctx, url)
+		var duplicate *store.DuplicateCodeError
+		if !errors.As(err, &duplicate) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %s", codegen.ErrExhausted, err)
 }
 
 // StringAccept принимает ссылку и возвращает закодированную ссылку
 func (s *APIServer) StringAccept(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeTextError(w, r, bodyError(err))
 		return
 	}
 
-	// пероверка на пустую ссылку
-	if len(strings.TrimSpace(string(body))) == 0 {
-		w.WriteHeader(http.StatusBadRequest)
+	// проверка и нормализация ссылки, в том числе на пустую ссылку
+	original, err := s.urls.Normalize(string(body))
+	if err != nil {
+		s.writeTextError(w, r, urlError(err))
 		return
 	}
 
-	// запись в хранилище
-	idForData := strconv.Itoa(store.IDStorage)
-	store.NextID(&store.IDStorage)
+	ctx, cancel := s.dbContext(r)
+	defer cancel()
 
-	hostForLink := r.Host
-	var link string
-
-	// проверка для работы флага b
-	if s.config.ShortURLAddr != "" {
-		hostForLink = s.config.ShortURLAddr
-		link = fmt.Sprintf("%s/%s", hostForLink, idForData)
-	} else {
-		link = fmt.Sprintf("http://%s/%s", hostForLink, idForData)
-	}
-
-	// для авторизации
-	if !authForFlag {
-		c, err := r.Cookie("token")
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		tknStr = c.Value
-	} else {
-		tknStr = authString
+	if err := s.checkURL(ctx, original); err != nil {
+		s.writeTextError(w, r, policyError(err))
+		return
 	}
 
-	creator, err := auth.GetUserID(tknStr)
+	// пользователь определён в Auth
+	creator, err := auth.UserID(r.Context())
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeTextError(w, r, userError(err))
 		return
 	}
 
-	url := store.NewURL(link, string(body), creator)
-	if err = s.Database.WriteURL(url, creator, &idForData); err != nil {
-		// проверка, что ссылка уже есть в базе
+	// запись в хранилище
+	url := store.NewURL("", original, creator)
+	if err = s.writeGenerated(ctx, url); err != nil {
+		// проверка, что ссылка уже есть в базе, в url.Code записан её код
 		if errors.Is(err, store.ErrConfilict) {
-
-			res, err := s.Database.Conflict(url)
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
-
 			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte(res))
+			w.Write([]byte(s.shortLink(r, url.Code)))
 			return
 		} else {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-	}
-
-	// проверка для работы флага b БД
-	if s.typeStore == "database" {
-		if s.config.ShortURLAddr != "" {
-			hostForLink = s.config.ShortURLAddr
-			link = fmt.Sprintf("%s/%s", hostForLink, idForData)
-		} else {
-			link = fmt.Sprintf("http://%s/%s", hostForLink, idForData)
-		}
-		urlResult := store.NewURL(link, string(body), creator)
-		// тут нужно перезаписать значения в базе
-		if err := s.Database.RewriteURL(urlResult); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			s.writeTextError(w, r, storageError(err))
 			return
 		}
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte(link))
+	w.Write([]byte(s.shortLink(r, url.Code)))
 
 }
 
 // StringBack принимает id и возвращает ссылку
 func (s *APIServer) StringBack(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.String()
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := s.dbContext(r)
+	defer cancel()
 
 	var url store.URL
 
-	if err := s.Database.ReadURL(&url, id[1:]); err != nil {
-		if errors.Is(err, store.ErrDeleted) {
-			w.WriteHeader(http.StatusGone)
+	if err := s.Database.ReadURL(ctx, &url, id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDeleted) || errors.Is(err, store.ErrExpired):
+			s.metrics.Redirect(metrics.RedirectGone)
+			s.writeError(w, r, newAPIError(http.StatusGone, codeGone, "short url %s", err))
+		case errors.Is(err, store.ErrNotFound):
+			s.metrics.Redirect(metrics.RedirectNotFound)
+			s.writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound, "short url not found"))
+		default:
+			s.metrics.Redirect(metrics.RedirectError)
+			s.writeError(w, r, storageError(err))
+		}
+		return
+	}
+
+	// ссылка могла попасть в блок-лист после сокращения
+	if err := s.checkURL(ctx, url.OriginalURL); err != nil {
+		if errors.Is(err, policy.ErrBlocked) {
+			s.metrics.Redirect(metrics.RedirectBlocked)
+			s.writeError(w, r, newAPIError(s.config.BlockedRedirectStatus, codeURLBlocked, "destination is blocked"))
 			return
 		}
-		w.WriteHeader(http.StatusNotFound)
+		s.metrics.Redirect(metrics.RedirectError)
+		s.writeError(w, r, policyError(err))
 		return
 	}
+	s.metrics.Redirect(metrics.RedirectOK)
+	s.recordClick(r, id)
+
 	w.Header().Set("Location", url.OriginalURL)
 	w.WriteHeader(http.StatusTemporaryRedirect)
 }
@@ -273,66 +652,75 @@ func (s *APIServer) StringBack(w http.ResponseWriter, r *http.Request) {
 func (s *APIServer) ShortenURL(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, r, bodyError(err))
 		return
 	}
 
 	var url shortenURL
 
 	if err := json.Unmarshal(body, &url); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, r, jsonError(err))
 		return
 	}
 
-	// проверка на пустую ссылку
-	if len(strings.TrimSpace(string(url.URL))) == 0 {
-		w.WriteHeader(http.StatusBadRequest)
+	// проверка и нормализация ссылки, в том числе на пустую ссылку
+	original, err := s.urls.Normalize(url.URL)
+	if err != nil {
+		s.writeError(w, r, urlError(err))
 		return
 	}
 
-	// запись в хранилище
-	idForData := strconv.Itoa(store.IDStorage)
-	store.NextID(&store.IDStorage)
+	expiresAt, err := url.deadline(time.Now())
+	if err != nil {
+		s.writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidExpiration, "%s", err))
+		return
+	}
 
-	hostForLink := r.Host
-	var link string
+	ctx, cancel := s.dbContext(r)
+	defer cancel()
 
-	// проверка для работы флага b
-	if s.config.ShortURLAddr != "" {
-		hostForLink = s.config.ShortURLAddr
-		link = fmt.Sprintf("%s/%s", hostForLink, idForData)
-	} else {
-		link = fmt.Sprintf("http://%s/%s", hostForLink, idForData)
+	if err := s.checkURL(ctx, original); err != nil {
+		s.writeError(w, r, policyError(err))
+		return
 	}
 
-	/// для авторизации
-	var tknStr string
-	if !authForFlag {
-		c, err := r.Cookie("token")
-		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+	if url.Alias != "" {
+		if err := s.aliases.Validate(url.Alias); err != nil {
+			s.writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidAlias, "%s", err))
 			return
 		}
-		tknStr = c.Value
-	} else {
-		tknStr = authString
 	}
 
-	creator, err := auth.GetUserID(tknStr)
+	// пользователь определён в Auth
+	creator, err := auth.UserID(r.Context())
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, r, userError(err))
 		return
 	}
 
-	urlNew := store.NewURL(link, url.URL, creator)
-	if err := s.Database.WriteURL(urlNew, creator, &idForData); err != nil {
-		// проверка, что ссылка уже есть в базе
+	// запись в хранилище под пользовательским или сгенерированным кодом
+	urlNew := store.NewURL(url.Alias, original, creator)
+	urlNew.ExpiresAt = expiresAt
+	if url.Alias != "" {
+		err = s.Database.WriteURL(ctx, urlNew)
+	} else {
+		err = s.writeGenerated(ctx, urlNew)
+	}
+	if err != nil {
+		// проверка, что пользовательский код уже занят
+		var duplicate *store.DuplicateCodeError
+		if errors.As(err, &duplicate) {
+			s.writeError(w, r, newAPIError(http.StatusConflict, codeCodeTaken, "%s", duplicate))
+			return
+		}
+
+		// проверка, что ссылка уже есть в базе, в urlNew.Code записан её код
 		if errors.Is(err, store.ErrConfilict) {
 
-			var result shortenURL
+			result := URLResult{ResultURL: s.shortLink(r, urlNew.Code)}
 			objectJSON, err := json.Marshal(result)
 			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
+				s.writeError(w, r, internalError(err))
 				return
 			}
 			w.Header().Set("Content-Type", "application/json")
@@ -341,35 +729,18 @@ func (s *APIServer) ShortenURL(w http.ResponseWriter, r *http.Request) {
 			return
 
 		} else {
-			fmt.Println(err)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-	}
-
-	// проверка для работы флага b БД
-	if s.typeStore == "database" {
-		if s.config.ShortURLAddr != "" {
-			hostForLink = s.config.ShortURLAddr
-			link = fmt.Sprintf("%s/%s", hostForLink, idForData)
-		} else {
-			link = fmt.Sprintf("http://%s/%s", hostForLink, idForData)
-		}
-		urlResult := store.NewURL(link, url.URL, creator)
-		// тут нужно перезаписать значения в базе
-		if err := s.Database.RewriteURL(urlResult); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			s.writeError(w, r, storageError(err))
 			return
 		}
 	}
 
 	// запись ссылки в структуру ответа
 	var result URLResult
-	result.ResultURL = link
+	result.ResultURL = s.shortLink(r, urlNew.Code)
 
 	objectJSON, err := json.Marshal(result)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, r, internalError(err))
 		return
 	}
 
@@ -384,82 +755,70 @@ func (s *APIServer) ShortenURL(w http.ResponseWriter, r *http.Request) {
 func (s *APIServer) BatchURL(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, r, bodyError(err))
 		return
 	}
 
 	var urls []batchURL
 
 	if err := json.Unmarshal(body, &urls); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, r, jsonError(err))
 		return
 	}
 
-	// проверка на пустую ссылку
-	for _, url := range urls {
-		if len(strings.TrimSpace(url.OriginalURL)) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
+	// проверка ссылок и срока жизни, в ошибке указывается correlation_id ссылки
+	now := time.Now()
+	deadlines := make([]time.Time, len(urls))
+	for i, url := range urls {
+		urls[i].OriginalURL, err = s.urls.Normalize(url.OriginalURL)
+		if err != nil {
+			s.writeError(w, r, urlError(err).withDetail("correlation_id", url.CorrelationID))
 			return
 		}
-	}
-
-	for i := 0; i < len(urls); i++ {
-		// запись в хранилище
-		idForData := strconv.Itoa(store.IDStorage)
-		store.NextID(&store.IDStorage)
-
-		hostForLink := r.Host
-		var link string
-
-		// проверка для работы флага b
-		if s.config.ShortURLAddr != "" {
-			hostForLink = s.config.ShortURLAddr
-			link = fmt.Sprintf("%s/%s", hostForLink, idForData)
-		} else {
-			link = fmt.Sprintf("http://%s/%s", hostForLink, idForData)
-		}
-
-		// для авторизации
-		if !authForFlag {
-			c, err := r.Cookie("token")
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
-			tknStr = c.Value
-		} else {
-			tknStr = authString
-		}
 
-		creator, err := auth.GetUserID(tknStr)
+		deadlines[i], err = url.deadline(now)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			s.writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidExpiration, "%s", err).
+				withDetail("correlation_id", url.CorrelationID))
 			return
 		}
+	}
+
+	// пользователь определён в Auth
+	creator, err := auth.UserID(r.Context())
+	if err != nil {
+		s.writeError(w, r, userError(err))
+		return
+	}
 
-		urlNew := store.NewURL(link, urls[i].OriginalURL, creator)
-		if err := s.Database.WriteURL(urlNew, creator, &idForData); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+	// таймаут общий для всей пачки
+	ctx, cancel := s.dbContext(r)
+	defer cancel()
+
+	// пачка отклоняется целиком до записи, если хотя бы одна ссылка запрещена
+	for _, url := range urls {
+		if err := s.checkURL(ctx, url.OriginalURL); err != nil {
+			s.writeError(w, r, policyError(err).withDetail("correlation_id", url.CorrelationID))
 			return
 		}
+	}
 
-		// проверка для работы флага b БД
-		if s.typeStore == "database" {
-			if s.config.ShortURLAddr != "" {
-				hostForLink = s.config.ShortURLAddr
-				link = fmt.Sprintf("%s/%s", hostForLink, idForData)
-			} else {
-				link = fmt.Sprintf("http://%s/%s", hostForLink, idForData)
-			}
-			urlResult := store.NewURL(link, urls[i].OriginalURL, creator)
-			// тут нужно перезаписать значения в базе
-			if err := s.Database.RewriteURL(urlResult); err != nil {
-				w.WriteHeader(http.StatusBadRequest)
+	// если часть ссылок уже сокращена, в ответе их существующие ссылки и статус 409
+	status := http.StatusCreated
+
+	for i := 0; i < len(urls); i++ {
+		// запись в хранилище
+		urlNew := store.NewURL("", urls[i].OriginalURL, creator)
+		urlNew.ExpiresAt = deadlines[i]
+		if err := s.writeGenerated(ctx, urlNew); err != nil {
+			if !errors.Is(err, store.ErrConfilict) {
+				s.writeError(w, r, storageError(err))
 				return
 			}
+			status = http.StatusConflict
 		}
 
-		urls[i].shortURL = link
+		urls[i].shortURL = s.shortLink(r, urlNew.Code)
 	}
 
 	// запись ссылки в структуру ответа
@@ -475,12 +834,12 @@ func (s *APIServer) BatchURL(w http.ResponseWriter, r *http.Request) {
 
 	objectJSON, err := json.Marshal(result)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, r, internalError(err))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	w.Write(objectJSON)
 }
 
@@ -488,34 +847,33 @@ func (s *APIServer) BatchURL(w http.ResponseWriter, r *http.Request) {
 func (s *APIServer) Ping(w http.ResponseWriter, r *http.Request) {
 	// проверка на работу только с базой данных.
 	if s.typeStore == "database" {
-		if err := s.Database.CheckPing(); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		ctx, cancel := s.dbContext(r)
+		defer cancel()
+
+		if err := s.Database.CheckPing(ctx); err != nil {
+			s.writeError(w, r, storageError(err))
 			return
 		}
 		w.WriteHeader(http.StatusOK)
 	} else {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, r, badRequestError("ping is available only for database storage"))
 	}
 }
 
 // GetAllURL возвращает пользователю все сокращенные им url.
 func (s *APIServer) GetAllURL(w http.ResponseWriter, r *http.Request) {
-	c, err := r.Cookie("token")
+	creator, err := sessionUserID(r)
 	if err != nil {
-		w.WriteHeader(http.StatusNoContent)
+		s.writeError(w, r, userError(err))
 		return
 	}
-	tknStr = c.Value
 
-	creator, err := auth.GetUserID(tknStr)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
+	ctx, cancel := s.dbContext(r)
+	defer cancel()
 
-	result, err := s.Database.GetAllURL(creator)
+	result, err := s.Database.GetAllURL(ctx, creator)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		s.writeError(w, r, storageError(err))
 		return
 	}
 
@@ -525,17 +883,9 @@ func (s *APIServer) GetAllURL(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resultForJSON := make([]resultURL, len(result))
-
-	if s.typeStore == "database" {
-		for i := 0; i < len(result); i++ {
-			resultForJSON[i].OriginalURL = result[i].ShortURL
-			resultForJSON[i].ShortURL = result[i].OriginalURL
-		}
-	} else {
-		for i := 0; i < len(result); i++ {
-			resultForJSON[i].OriginalURL = result[i].OriginalURL
-			resultForJSON[i].ShortURL = result[i].ShortURL
-		}
+	for i := 0; i < len(result); i++ {
+		resultForJSON[i].OriginalURL = result[i].OriginalURL
+		resultForJSON[i].ShortURL = s.shortLink(r, result[i].Code)
 	}
 
 	if len(resultForJSON) == 0 {
@@ -545,7 +895,7 @@ func (s *APIServer) GetAllURL(w http.ResponseWriter, r *http.Request) {
 
 	objectJSON, err := json.Marshal(resultForJSON)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, r, internalError(err))
 		return
 	}
 
@@ -556,105 +906,149 @@ func (s *APIServer) GetAllURL(w http.ResponseWriter, r *http.Request) {
 
 // DeleteURL удаляет указанные url у текущего пользователя.
 func (s *APIServer) DeleteURL(w http.ResponseWriter, r *http.Request) {
-
-	c, err := r.Cookie("token")
-	if err != nil {
-		w.WriteHeader(http.StatusNoContent)
-		return
-	}
-	tknStr = c.Value
-
-	creator, err := auth.GetUserID(tknStr)
+	creator, err := sessionUserID(r)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, r, userError(err))
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, r, bodyError(err))
 		return
 	}
 
 	var urls []string
 
 	if err := json.Unmarshal(body, &urls); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, r, jsonError(err))
 		return
 	}
 
 	// проверка на пустую ссылку
 	for _, url := range urls {
 		if len(strings.TrimSpace(url)) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
+			s.writeError(w, r, badRequestError("short url code is empty"))
 			return
 		}
 	}
 
-	hostForLink := r.Host
-	var lin string
-
 	// удаление url
 	for _, url := range urls {
 
-		// проверка для работы флага b
-		if s.config.ShortURLAddr != "" {
-			hostForLink = s.config.ShortURLAddr
-			lin = fmt.Sprintf("%s/%s", hostForLink, url)
-		} else {
-			lin = fmt.Sprintf("http://%s/%s", hostForLink, url)
-		}
-
 		// асинхронное удаление ссылок
-		var t store.Task
-		t.Link = lin
-		t.Creator = creator
-		s.worker.Push(&t)
+		s.worker.Push(store.NewTask(url, creator))
 	}
 
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// newUser выдаёт идентификатор и токен новому пользователю.
+func (s *APIServer) newUser(ctx context.Context) (string, int, error) {
+	id, err := s.users.NextUserID(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+
+	token, err := s.keys.Sign(id)
+	if err != nil {
+		return "", 0, err
+	}
+	return token, id, nil
+}
+
+// setTokenCookie отправляет токен пользователю.
+// С префиксом base_url cookie действует для всех маршрутов под ним.
+func (s *APIServer) setTokenCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Value:    token,
+		Path:     s.config.BaseURL.Prefix(),
+		HttpOnly: true,
+	})
+}
+
+// sessionUserID возвращает пользователя из действующего токена или API ключа,
+// не создавая нового. Без такого пользователя возвращается auth.ErrNoUser.
+func sessionUserID(r *http.Request) (int, error) {
+	if id, ok := auth.UserIDFromContext(r.Context()); ok {
+		return id, nil
+	}
+	return 0, auth.ErrNoUser
+}
+
 // Auth middleware для авторизации пользователя.
+// Пользователь определяется один раз и сохраняется в контексте запроса,
+// откуда его читают обработчики через auth.UserID.
+// С заголовком Authorization: Bearer <key> пользователь определяется по API ключу,
+// а его области действия сохраняются в контексте. Недействительный ключ даёт 401.
+// Без cookie или с недействительным токеном новый пользователь и его токен
+// создаются при первом обращении обработчика к auth.UserID.
+// Обработчики, читающие данные пользователя, используют sessionUserID и отвечают 401.
 func (s *APIServer) Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenFlag := false
-		var token string
+		if secret, ok, err := bearerKey(r); ok {
+			if err != nil {
+				s.writeError(w, r, newAPIError(http.StatusUnauthorized, codeInvalidAPIKey, "%s", err))
+				return
+			}
 
-		// проверка на cуществование cookie
-		c, err := r.Cookie("token")
-		if err != nil {
-			if errors.Is(err, http.ErrNoCookie) {
-				token, err = auth.BuildJWTString()
-				if err != nil {
-					w.WriteHeader(http.StatusBadRequest)
+			ctx, cancel := s.dbContext(r)
+			key, err := s.apiKeys.APIKeyByHash(ctx, auth.HashAPIKey(secret))
+			cancel()
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					s.writeError(w, r, newAPIError(http.StatusUnauthorized, codeInvalidAPIKey, "invalid api key"))
 					return
 				}
-				tokenFlag = true
-			} else {
-				w.WriteHeader(http.StatusBadRequest)
+				s.writeError(w, r, storageError(err))
 				return
 			}
 
+			ctx = auth.WithScopes(auth.WithUserID(r.Context(), key.UserID), key.Scopes)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
 		}
 
-		if !tokenFlag {
-			tknStr = c.Value
-		} else {
-			tknStr = token
+		// недействительный токен (чужая подпись, истёкший срок, неизвестный kid)
+		// обрабатывается так же, как отсутствующий
+		var claims *auth.Claims
+		var refresh bool
+		c, err := r.Cookie("token")
+		if err == nil {
+			claims, refresh, err = s.keys.NeedsRefresh(c.Value, time.Now())
 		}
+		if err != nil {
+			// идентификатор выдаётся, только когда он нужен обработчику,
+			// чтобы переходы и другие открытые маршруты не создавали пользователей
+			alloc := func() (int, error) {
+				ctx, cancel := s.dbContext(r)
+				defer cancel()
 
-		if tokenFlag {
-			authForFlag = true
-			authString = token
-			http.SetCookie(w, &http.Cookie{
-				Name:     "token",
-				Value:    token,
-				HttpOnly: true,
-			})
+				token, id, err := s.newUser(ctx)
+				if err != nil {
+					return 0, err
+				}
+				s.setTokenCookie(w, token)
+				return id, nil
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithLazyUserID(r.Context(), alloc)))
+			return
+		}
 
+		// перевыпуск токена, который скоро истечёт или подписан предыдущим ключом
+		sign := s.keys.Sign
+		ctx := auth.WithUserID(r.Context(), claims.UserID)
+		if claims.Registered {
+			sign = s.keys.SignRegistered
+			ctx = auth.WithRegistered(ctx)
+		}
+		if refresh {
+			if token, err := sign(claims.UserID); err == nil {
+				s.setTokenCookie(w, token)
+			}
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,91 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// BaseURL базовый адрес сокращённых ссылок: схема http или https, хост с необязательным
+// портом, в том числе IPv6 в квадратных скобках, и необязательный префикс пути,
+// например https://go.example.com/s. Нулевое значение означает адрес запроса.
+type BaseURL struct {
+	url url.URL
+}
+
+// ParseBaseURL разбирает базовый адрес. Завершающий слэш префикса отбрасывается.
+func ParseBaseURL(s string) (BaseURL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return BaseURL{}, fmt.Errorf("invalid base url %q - %w", s, err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return BaseURL{}, fmt.Errorf("base url %q must be an absolute http or https URL", s)
+	case u.Hostname() == "":
+		return BaseURL{}, fmt.Errorf("base url %q has no host", s)
+	case strings.Count(u.Host, ":") > 1 && !strings.HasPrefix(u.Host, "["):
+		return BaseURL{}, fmt.Errorf("base url %q must put an IPv6 host in square brackets", s)
+	case u.User != nil || u.RawQuery != "" || u.Fragment != "" || u.ForceQuery:
+		return BaseURL{}, fmt.Errorf("base url %q must not contain user info, query or fragment", s)
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return BaseURL{}, fmt.Errorf("base url %q has invalid port", s)
+		}
+	}
+
+	u.Path = strings.TrimSuffix(path.Clean("/"+u.Path), "/")
+	u.RawPath = ""
+	return BaseURL{url: *u}, nil
+}
+
+// requestBaseURL возвращает базовый адрес по хосту запроса.
+func requestBaseURL(r *http.Request) BaseURL {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return BaseURL{url: url.URL{Scheme: scheme, Host: r.Host}}
+}
+
+// IsZero сообщает, что адрес не задан.
+func (b BaseURL) IsZero() bool {
+	return b.url.Host == ""
+}
+
+// Prefix возвращает префикс пути без завершающего слэша или пустую строку.
+func (b BaseURL) Prefix() string {
+	return b.url.Path
+}
+
+// Link возвращает сокращённую ссылку для кода.
+func (b BaseURL) Link(code string) string {
+	return b.url.JoinPath(code).String()
+}
+
+func (b BaseURL) String() string {
+	if b.IsZero() {
+		return ""
+	}
+	return b.url.String()
+}
+
+// Set разбирает адрес для конфигурации. Пустая строка сбрасывает адрес.
+func (b *BaseURL) Set(s string) error {
+	if s == "" {
+		*b = BaseURL{}
+		return nil
+	}
+	parsed, err := ParseBaseURL(s)
+	if err != nil {
+		return err
+	}
+	*b = parsed
+	return nil
+}
@@ -1,62 +1,150 @@
 package apiserver
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/auth"
+	"github.com/AlexCorn999/short-url-service/internal/app/codegen"
+	"github.com/AlexCorn999/short-url-service/internal/app/logger"
+	"github.com/AlexCorn999/short-url-service/internal/app/ratelimit"
+	"github.com/AlexCorn999/short-url-service/internal/app/tracing"
+	"github.com/AlexCorn999/short-url-service/internal/app/urlnorm"
+	"github.com/AlexCorn999/short-url-service/internal/app/worker"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 )
 
 // Config ...
 type Config struct {
-	bindAddr     string
-	ShortURLAddr string
-	databaseAddr string
-	FilePath     string
-	LogLevel     string
+	bindAddr        string
+	BaseURL         BaseURL
+	databaseAddr    string
+	FilePath        string
+	LogLevel        string
+	CodeGenerator   string
+	CodeLength      int
+	CodeSalt        string
+	AliasCharset    string
+	AliasMinLen     int
+	AliasMaxLen     int
+	ReservedCodes   []string
+	ReapInterval    time.Duration
+	AnalyticsSalt   string
+	DBTimeout       time.Duration
+	ShutdownTimeout time.Duration
+	// HS256 секрет или путь к файлу с секретом либо закрытым ключом в PEM
+	JWTSecret     string
+	JWTSecretFile string
+	JWTAlgorithm  string
+	JWTKeyID      string
+	// ключи для проверки токенов после смены ключа в виде kid:alg:path
+	JWTPreviousKeys    []string
+	TokenExp           time.Duration
+	TokenRefreshBefore time.Duration
+	// ограничения частоты запросов вида N/s, N/m или N/h, off отключает ограничение.
+	// По умолчанию отключены и включаются оператором.
+	RateLimitCreate   string
+	RateLimitRedirect string
+	RateLimitDelete   string
+	// memory или postgres для общего ограничения нескольких экземпляров
+	RateLimitBackend string
+	// правила проверки исходных ссылок, пустая схема по умолчанию отключает её подстановку
+	URLAllowedSchemes []string
+	URLDefaultScheme  string
+	URLMaxLength      int
+	// блок-лист доменов и выражений, перечитывается при изменении
+	URLBlocklistFile   string
+	URLBlocklistReload time.Duration
+	// внешний сервис репутации ссылок
+	URLPolicyEndpoint string
+	URLPolicyTimeout  time.Duration
+	URLPolicyCacheTTL time.Duration
+	// при недоступности сервиса репутации ссылки разрешаются
+	URLPolicyFailOpen bool
+	// статус перехода по запрещённой ссылке: 451 или 410
+	BlockedRedirectStatus int
+	// максимальный размер тела запроса в байтах, больший запрос получает 413
+	MaxBodySize int64
+	// метрики Prometheus на /metrics
+	MetricsEnabled bool
+	// экспортёр трассировки: none, stdout или otlp
+	TracingExporter string
+	// адрес коллектора OTLP/HTTP
+	TracingEndpoint    string
+	TracingSampleRatio float64
+	ServiceName        string
+	// формат логов: text или json
+	LogFormat string
+	// доля записываемых в журнал запросов успешных перенаправлений, от 0 до 1
+	LogRedirectSample float64
+	// период сохранения пачек в очередях удаления и статистики
+	WorkerBatchInterval time.Duration
+	// вывести конфигурацию и завершиться, задаётся флагом -print-config
+	PrintConfig bool
 }
 
 // NewConfig ...
 func NewConfig() *Config {
 	return &Config{
-		bindAddr: ":8080",
-		LogLevel: "debug",
+		bindAddr:        ":8080",
+		LogLevel:        "debug",
+		CodeGenerator:   codegen.StrategyBase62,
+		CodeLength:      8,
+		AliasCharset:    codegen.DefaultAliasCharset,
+		AliasMinLen:     3,
+		AliasMaxLen:     64,
+		ReservedCodes:   codegen.DefaultReserved,
+		ReapInterval:    time.Minute,
+		DBTimeout:       3 * time.Second,
+		ShutdownTimeout: 10 * time.Second,
+		JWTAlgorithm:    auth.AlgHS256,
+		JWTKeyID:        "default",
+		TokenExp:        3 * time.Hour,
+		// за час до истечения
+		TokenRefreshBefore: time.Hour,
+		RateLimitCreate:    "off",
+		RateLimitRedirect:  "off",
+		RateLimitDelete:    "off",
+		RateLimitBackend:   rateLimitMemory,
+		URLAllowedSchemes:  urlnorm.DefaultSchemes,
+		URLDefaultScheme:   "http",
+		URLMaxLength:       urlnorm.DefaultMaxLength,
+		URLBlocklistReload: 30 * time.Second,
+		URLPolicyTimeout:   2 * time.Second,
+		URLPolicyCacheTTL:  5 * time.Minute,
+		URLPolicyFailOpen:  true,
+		// 451 Unavailable For Legal Reasons
+		BlockedRedirectStatus: http.StatusUnavailableForLegalReasons,
+		MaxBodySize:           1 << 20,
+		MetricsEnabled:        true,
+		TracingExporter:       tracing.ExporterNone,
+		TracingEndpoint:       "http://localhost:4318/v1/traces",
+		TracingSampleRatio:    1,
+		ServiceName:           "short-url-service",
+		LogFormat:             logger.FormatText,
+		LogRedirectSample:     1,
+		WorkerBatchInterval:   worker.DefaultInterval,
 	}
 }
 
-// NetAddress структура для проверки флага a
+// NetAddress структура для проверки адреса сервера host:port
 type NetAddress struct {
 	Host string
 	Port int
 }
 
-// URLAddress cтруктура для проверки флага b
-type URLAddress struct {
-	http string
-	Host string
-	Port int
-}
-
-func (u URLAddress) String() string {
-	return u.http + ":" + u.Host + ":" + strconv.Itoa(u.Port)
-}
-
-func (u *URLAddress) Set(s string) error {
-	hp := strings.Split(s, ":")
-	if len(hp) != 3 {
-		return errors.New("need address in a form host:port")
-	}
-	port, err := strconv.Atoi(hp[2])
-	if err != nil {
-		return err
-	}
-	u.http = hp[0]
-	u.Host = hp[1]
-	u.Port = port
-	return nil
-}
-
 func (a NetAddress) String() string {
 	return a.Host + ":" + strconv.Itoa(a.Port)
 }
@@ -75,53 +163,259 @@ func (a *NetAddress) Set(s string) error {
 	return nil
 }
 
-// ParseFlags обрабатывает аргументы командной строки и сохраняет их значения в соответствующих переменных.
-func (c *Config) ParseFlags() {
+// ParseFlags загружает конфигурацию из аргументов командной строки, переменных окружения
+// и файла конфигурации. Подробнее в Load.
+func (c *Config) ParseFlags() error {
+	return c.Load(os.Args[1:])
+}
 
-	addr := new(NetAddress)
-	_ = flag.Value(addr)
+// Load заполняет конфигурацию в порядке возрастания приоритета: значения по умолчанию,
+// файл конфигурации из флага -c или переменной CONFIG, переменные окружения, флаги args.
+// Пустые переменные окружения не учитываются. После загрузки значения проверяются Validate.
+func (c *Config) Load(args []string) error {
+	fs := flag.NewFlagSet("shortener", flag.ContinueOnError)
+	configFile := fs.String("c", os.Getenv("CONFIG"), "config file in YAML or JSON")
+	fs.StringVar(configFile, "config", os.Getenv("CONFIG"), "config file in YAML or JSON")
+	fs.BoolVar(&c.PrintConfig, "print-config", false, "print the effective config with secrets redacted and exit")
 
-	urlAddr := new(URLAddress)
-	_ = flag.Value(urlAddr)
+	// флаги применяются после файла и переменных окружения, поэтому сначала только запоминаются
+	for _, st := range settings {
+		v := &flagValue{setting: st, value: st.value(c).String()}
+		fs.Var(v, st.flag(), st.usage)
+		if st.short != "" {
+			fs.Var(v, st.short, st.usage+" (shorthand for -"+st.flag()+")")
+		}
+	}
+	// ошибки возвращаются вызывающему, справка выводится только по -h
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fs.SetOutput(os.Stderr)
+			fs.PrintDefaults()
+		}
+		return err
+	}
 
-	flag.Var(addr, "a", "Net address host:port")
-	flag.Var(urlAddr, "b", "address and port for short URL")
-	// /tmp/short-url-db.json
-	filePath := flag.String("f", "", "filePath for URL")
-	// host=127.0.0.1 port=5432 user=postgres sslmode=disable password=1234
-	dataAddr := flag.String("d", "", "port for database")
+	if *configFile != "" {
+		values, err := readConfigFile(*configFile)
+		if err != nil {
+			return err
+		}
+		for _, key := range sortedKeys(values) {
+			s, ok := lookupSetting(key)
+			if !ok {
+				return fmt.Errorf("config file %s: unknown setting %q", *configFile, key)
+			}
+			if err := s.value(c).Set(values[key]); err != nil {
+				return fmt.Errorf("config file %s: %s: %w", *configFile, key, err)
+			}
+		}
+	}
 
-	flag.Parse()
-	c.FilePath = *filePath
-	c.databaseAddr = *dataAddr
+	for _, s := range settings {
+		if env := os.Getenv(s.env()); env != "" {
+			if err := s.value(c).Set(env); err != nil {
+				return fmt.Errorf("env %s: %w", s.env(), err)
+			}
+		}
+	}
 
-	// проверка значения addr, чтобы записать в переменную bindAddr
-	if addr.String() != ":0" {
-		c.bindAddr = addr.String()
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		v, ok := f.Value.(*flagValue)
+		if !ok || flagErr != nil {
+			return
+		}
+		if err := v.setting.value(c).Set(v.value); err != nil {
+			flagErr = fmt.Errorf("flag -%s: %w", f.Name, err)
+		}
+	})
+	if flagErr != nil {
+		return flagErr
 	}
 
-	// проверка значения urlAddr, чтобы записать в переменную shortURLAddr
-	if urlAddr.String() != "::0" {
-		c.ShortURLAddr = urlAddr.String()
+	return c.Validate()
+}
+
+// Validate проверяет значения параметров и возвращает ошибку со всеми неверными параметрами.
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, key+" "+fmt.Sprintf(format, args...))
+		}
+	}
+
+	_, err := log.ParseLevel(c.LogLevel)
+	check(err == nil, "log_level", "must be one of panic, fatal, error, warn, info, debug, trace")
+	_, err = logger.NewFormatter(c.LogFormat)
+	check(err == nil, "log_format", "must be %s or %s", logger.FormatText, logger.FormatJSON)
+	check(c.LogRedirectSample >= 0 && c.LogRedirectSample <= 1, "log_redirect_sample", "must be between 0 and 1")
+
+	switch c.CodeGenerator {
+	case codegen.StrategyBase62, codegen.StrategyRandom, codegen.StrategyHashids:
+	default:
+		check(false, "code_generator", "must be %s, %s or %s", codegen.StrategyBase62, codegen.StrategyRandom, codegen.StrategyHashids)
 	}
+	check(c.CodeLength > 0, "code_length", "must be positive")
+	check(c.AliasCharset != "", "alias_charset", "must not be empty")
+	check(c.AliasMinLen > 0, "alias_min_length", "must be positive")
+	check(c.AliasMaxLen >= c.AliasMinLen, "alias_max_length", "must not be less than alias_min_length")
 
-	// Установка данных адреса запуска HTTP-сервера через переменные окружения
-	if envRunAddr := os.Getenv("SERVER_ADDRESS"); envRunAddr != "" {
-		c.bindAddr = envRunAddr
+	for key, d := range map[string]time.Duration{
+		"reap_interval":         c.ReapInterval,
+		"worker_batch_interval": c.WorkerBatchInterval,
+		"db_timeout":            c.DBTimeout,
+		"shutdown_timeout":      c.ShutdownTimeout,
+		"token_exp":             c.TokenExp,
+		"url_blocklist_reload":  c.URLBlocklistReload,
+		"url_policy_timeout":    c.URLPolicyTimeout,
+	} {
+		check(d > 0, key, "must be positive")
 	}
+	check(c.TokenRefreshBefore >= 0, "token_refresh_before", "must not be negative")
+	check(c.URLPolicyCacheTTL >= 0, "url_policy_cache_ttl", "must not be negative")
 
-	// Установка базового адреса результирующего сокращённого URL через переменные окружения
-	if envShortURL := os.Getenv("BASE_URL"); envShortURL != "" {
-		c.ShortURLAddr = envShortURL
+	switch c.JWTAlgorithm {
+	case auth.AlgHS256, auth.AlgRS256, auth.AlgEdDSA:
+	default:
+		check(false, "jwt_algorithm", "must be %s, %s or %s", auth.AlgHS256, auth.AlgRS256, auth.AlgEdDSA)
 	}
 
-	// Установка пути к файлу сохранения URL через переменные окружения
-	if envPath := os.Getenv("FILE_STORAGE_PATH"); envPath != "" {
-		c.FilePath = envPath
+	for key, limit := range map[string]string{
+		"rate_limit_create":   c.RateLimitCreate,
+		"rate_limit_redirect": c.RateLimitRedirect,
+		"rate_limit_delete":   c.RateLimitDelete,
+	} {
+		_, err := ratelimit.ParseLimit(limit)
+		check(err == nil, key, "must be N/s, N/m, N/h or off")
+	}
+	check(c.RateLimitBackend == rateLimitMemory || c.RateLimitBackend == rateLimitPostgres,
+		"rate_limit_backend", "must be %s or %s", rateLimitMemory, rateLimitPostgres)
+
+	check(len(c.URLAllowedSchemes) > 0, "url_allowed_schemes", "must not be empty")
+	check(c.URLMaxLength > 0, "url_max_length", "must be positive")
+	check(c.MaxBodySize > 0, "max_body_size", "must be positive")
+	check(c.BlockedRedirectStatus == http.StatusUnavailableForLegalReasons || c.BlockedRedirectStatus == http.StatusGone,
+		"blocked_redirect_status", "must be %d or %d", http.StatusUnavailableForLegalReasons, http.StatusGone)
+
+	switch c.TracingExporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		check(false, "tracing_exporter", "must be %s, %s or %s", tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP)
 	}
+	check(c.TracingSampleRatio >= 0 && c.TracingSampleRatio <= 1, "tracing_sample_ratio", "must be between 0 and 1")
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Print выводит действующую конфигурацию в формате файла конфигурации YAML.
+// Заданные секреты заменяются на REDACTED.
+func (c *Config) Print(w io.Writer) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range settings {
+		v := s.value(c)
+		node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v.String()}
+		switch v.(type) {
+		case *intValue, *int64Value, *floatValue, *boolValue:
+			// числа и логические значения без кавычек
+			node.Tag = ""
+		}
+		if s.secret && node.Value != "" {
+			node.Value = redacted
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s.key}, node)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// redacted заменяет секреты в выводе конфигурации.
+const redacted = "REDACTED"
+
+// flagValue запоминает значение флага параметра до применения.
+type flagValue struct {
+	setting setting
+	value   string
+}
+
+func (v *flagValue) Set(s string) error { v.value = s; return nil }
+func (v *flagValue) String() string     { return v.value }
+
+// IsBoolFlag позволяет задавать логические параметры флагом без значения.
+func (v *flagValue) IsBoolFlag() bool {
+	_, ok := v.setting.value(&Config{}).(*boolValue)
+	return ok
+}
+
+// readConfigFile читает файл конфигурации. Файлы .json разбираются как JSON, остальные как YAML.
+// Списки можно задавать массивами или строкой через запятую.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file - %w", err)
+	}
+
+	raw := make(map[string]interface{})
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s - %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, v := range raw {
+		s, err := configString(v)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %s: %w", path, key, err)
+		}
+		values[key] = s
+	}
+	return values, nil
+}
+
+// configString приводит значение из файла к строке, как в переменной окружения.
+func configString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := configString(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		return "", errors.New("must be a scalar or a list")
+	}
+	return fmt.Sprint(v), nil
+}
 
-	// Установка порта подключения к базе данных через переменные окружения
-	if envPath := os.Getenv("DATABASE_DSN"); envPath != "" {
-		c.databaseAddr = envPath
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
+	return keys
 }
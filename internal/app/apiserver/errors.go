@@ -0,0 +1,210 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/auth"
+	"github.com/AlexCorn999/short-url-service/internal/app/policy"
+	"github.com/AlexCorn999/short-url-service/internal/app/requestid"
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	"github.com/AlexCorn999/short-url-service/internal/app/urlnorm"
+)
+
+// Коды ошибок API. Ошибки проверки ссылок используют коды urlnorm.
+const (
+	codeBadRequest         = "bad_request"
+	codeInvalidJSON        = "invalid_json"
+	codeBodyTooLarge       = "body_too_large"
+	codeInvalidExpiration  = "invalid_expiration"
+	codeInvalidAlias       = "invalid_alias"
+	codeInvalidCredentials = "invalid_credentials"
+	codeInvalidScope       = "invalid_scope"
+	codeCodeTaken          = "code_taken"
+	codeUserExists         = "user_exists"
+	codeUnauthorized       = "unauthorized"
+	codeInvalidAPIKey      = "invalid_api_key"
+	codeForbidden          = "forbidden"
+	codeURLBlocked         = "url_blocked"
+	codeNotFound           = "not_found"
+	codeGone               = "gone"
+	codeRateLimited        = "rate_limited"
+	codeStorageTimeout     = "storage_timeout"
+	codeUnavailable        = "unavailable"
+	codeInternal           = "internal_error"
+)
+
+// apiError ошибка для ответа клиенту.
+// Причина cause не отправляется клиенту и попадает только в лог.
+type apiError struct {
+	Status    int               `json:"-"`
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	cause     error
+}
+
+func newAPIError(status int, code, format string, args ...interface{}) *apiError {
+	return &apiError{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// withDetail добавляет к ошибке подробность.
+func (e *apiError) withDetail(key, value string) *apiError {
+	if e.Details == nil {
+		e.Details = make(map[string]string)
+	}
+	e.Details[key] = value
+	return e
+}
+
+// withCause запоминает причину ошибки для лога.
+func (e *apiError) withCause(err error) *apiError {
+	e.cause = err
+	return e
+}
+
+// badRequestError ошибка 400 с кодом bad_request.
+func badRequestError(format string, args ...interface{}) *apiError {
+	return newAPIError(http.StatusBadRequest, codeBadRequest, format, args...)
+}
+
+// unauthorizedError возвращается, когда пользователь не определён: токен недействителен.
+func unauthorizedError() *apiError {
+	return newAPIError(http.StatusUnauthorized, codeUnauthorized, "token is missing or invalid")
+}
+
+// userError возвращает ошибку определения пользователя: 401, если его нет,
+// иначе ошибку хранилища, в котором он создавался.
+func userError(err error) *apiError {
+	if errors.Is(err, auth.ErrNoUser) {
+		return unauthorizedError()
+	}
+	return storageError(err)
+}
+
+// internalError ошибка 500, причина попадает только в лог.
+func internalError(err error) *apiError {
+	return newAPIError(http.StatusInternalServerError, codeInternal, "internal error").withCause(err)
+}
+
+// storageError возвращает ошибку для сбоя хранилища.
+// Истёкший таймаут даёт 504, отменённый запрос или закрытое хранилище — 503, остальное — 500.
+func storageError(err error) *apiError {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return newAPIError(http.StatusGatewayTimeout, codeStorageTimeout, "storage did not respond in time").withCause(err)
+	case errors.Is(err, context.Canceled), errors.Is(err, store.ErrClosed):
+		return newAPIError(http.StatusServiceUnavailable, codeUnavailable, "storage is unavailable").withCause(err)
+	}
+	return internalError(err)
+}
+
+// bodyError возвращает ошибку чтения тела запроса: 413 для слишком большого тела, иначе 400.
+func bodyError(err error) *apiError {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return newAPIError(http.StatusRequestEntityTooLarge, codeBodyTooLarge, "request body is larger than %d bytes", tooLarge.Limit)
+	}
+	return badRequestError("can't read request body").withCause(err)
+}
+
+// jsonError возвращает ошибку разбора JSON тела запроса.
+func jsonError(err error) *apiError {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return bodyError(err)
+	}
+	return newAPIError(http.StatusBadRequest, codeInvalidJSON, "request body is not valid JSON")
+}
+
+// urlError возвращает ошибку проверки ссылки с кодом urlnorm.
+func urlError(err error) *apiError {
+	var validation *urlnorm.Error
+	if errors.As(err, &validation) {
+		return newAPIError(http.StatusBadRequest, validation.Code, "%s", validation.Message)
+	}
+	return badRequestError("%s", err)
+}
+
+// policyError возвращает ошибку политики: 403 для запрещённой ссылки,
+// иначе ошибку недоступной политики.
+func policyError(err error) *apiError {
+	if errors.Is(err, policy.ErrBlocked) {
+		return newAPIError(http.StatusForbidden, codeURLBlocked, "%s", err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return newAPIError(http.StatusGatewayTimeout, codeStorageTimeout, "url policy did not respond in time").withCause(err)
+	}
+	return newAPIError(http.StatusServiceUnavailable, codeUnavailable, "url policy is unavailable").withCause(err)
+}
+
+// writeError отправляет ошибку в виде JSON объекта
+// {"code":"<code>","message":"<message>","details":{...},"request_id":"<id>"}.
+// Ошибки сервера записываются в лог вместе с причиной.
+func (s *APIServer) writeError(w http.ResponseWriter, r *http.Request, e *apiError) {
+	e.RequestID = requestid.FromContext(r.Context())
+	s.logError(r, e)
+
+	objectJSON, err := json.Marshal(e)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	w.Write(objectJSON)
+}
+
+// writeTextError отправляет ошибку текстом для text/plain обработчиков.
+// Если клиент принимает только JSON, ошибка отправляется как в writeError.
+func (s *APIServer) writeTextError(w http.ResponseWriter, r *http.Request, e *apiError) {
+	if prefersJSON(r) {
+		s.writeError(w, r, e)
+		return
+	}
+
+	s.logError(r, e)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(e.Status)
+	w.Write([]byte(e.Message))
+}
+
+func (s *APIServer) logError(r *http.Request, e *apiError) {
+	if e.Status < http.StatusInternalServerError {
+		return
+	}
+	entry := s.logger.WithContext(r.Context()).WithField("request_id", requestid.FromContext(r.Context())).WithField("code", e.Code)
+	if e.cause != nil {
+		entry.Error(e.cause)
+		return
+	}
+	entry.Error(e.Message)
+}
+
+// prefersJSON сообщает, что в заголовке Accept есть application/json, а text/plain нет.
+func prefersJSON(r *http.Request) bool {
+	json, text := false, false
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			json = true
+		case "text/plain", "text/*", "*/*":
+			text = true
+		}
+	}
+	return json && !text
+}
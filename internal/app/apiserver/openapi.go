@@ -0,0 +1,18 @@
+package apiserver
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec спецификация API, описывает все маршруты configureRouter.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPI возвращает спецификацию API в формате OpenAPI 3.
+func (s *APIServer) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPISpec)
+}
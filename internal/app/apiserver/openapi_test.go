@@ -0,0 +1,76 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	server := New(NewConfig())
+	server.configureRouter()
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(openAPISpec, &spec))
+
+	var documented []string
+	for path, item := range spec.Paths {
+		for method := range item {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	var routes []string
+	require.NoError(t, chi.Walk(server.router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routes = append(routes, method+" "+route)
+		return nil
+	}))
+
+	sort.Strings(documented)
+	sort.Strings(routes)
+	assert.Equal(t, routes, documented, "openapi.json must describe every route of configureRouter")
+}
+
+func TestOpenAPIRefs(t *testing.T) {
+	var spec map[string]interface{}
+	require.NoError(t, json.Unmarshal(openAPISpec, &spec))
+
+	// resolve возвращает объект по локальной ссылке #/a/b/c
+	resolve := func(ref string) interface{} {
+		var node interface{} = spec
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			object, ok := node.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			node = object[part]
+		}
+		return node
+	}
+
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch v := node.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				assert.NotNil(t, resolve(ref), ref)
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(spec)
+}
@@ -0,0 +1,53 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/policy"
+)
+
+// configurePolicy собирает политику проверки ссылок из блок-листа и сервиса репутации.
+// Без настроек ссылки не проверяются.
+func (s *APIServer) configurePolicy() error {
+	switch s.config.BlockedRedirectStatus {
+	case http.StatusUnavailableForLegalReasons, http.StatusGone:
+	default:
+		return fmt.Errorf("blocked redirect status must be %d or %d, got %d",
+			http.StatusUnavailableForLegalReasons, http.StatusGone, s.config.BlockedRedirectStatus)
+	}
+
+	var chain policy.Chain
+	if s.config.URLBlocklistFile != "" {
+		blocklist, err := policy.NewBlocklist(s.config.URLBlocklistFile, s.logger)
+		if err != nil {
+			return err
+		}
+		s.blocklist = blocklist
+		chain = append(chain, blocklist)
+	}
+
+	// сначала локальный блок-лист, чтобы не обращаться к сервису за известными ссылками
+	if s.config.URLPolicyEndpoint != "" {
+		chain = append(chain, policy.NewHTTPCallout(policy.HTTPOptions{
+			Endpoint: s.config.URLPolicyEndpoint,
+			Timeout:  s.config.URLPolicyTimeout,
+			CacheTTL: s.config.URLPolicyCacheTTL,
+			FailOpen: s.config.URLPolicyFailOpen,
+		}))
+	}
+
+	if len(chain) > 0 {
+		s.policy = chain
+	}
+	return nil
+}
+
+// checkURL проверяет ссылку политикой, если она задана.
+func (s *APIServer) checkURL(ctx context.Context, original string) error {
+	if s.policy == nil {
+		return nil
+	}
+	return s.policy.Check(ctx, original)
+}
@@ -0,0 +1,125 @@
+package apiserver
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/auth"
+	"github.com/AlexCorn999/short-url-service/internal/app/ratelimit"
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+)
+
+// Хранилища корзин ограничителя частоты запросов.
+const (
+	rateLimitMemory   = "memory"
+	rateLimitPostgres = "postgres"
+)
+
+// configureRateLimit разбирает ограничения групп маршрутов и выбирает хранилище корзин.
+// Хранилище данных должно быть уже настроено.
+func (s *APIServer) configureRateLimit() error {
+	limits := make(map[string]ratelimit.Limit)
+	for group, value := range map[string]string{
+		ratelimit.GroupCreate:   s.config.RateLimitCreate,
+		ratelimit.GroupRedirect: s.config.RateLimitRedirect,
+		ratelimit.GroupDelete:   s.config.RateLimitDelete,
+	} {
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			return fmt.Errorf("rate limit %s: %w", group, err)
+		}
+		limits[group] = limit
+	}
+
+	switch s.config.RateLimitBackend {
+	case rateLimitMemory:
+		s.limiter = ratelimit.NewMemory()
+	case rateLimitPostgres:
+		db, ok := unwrapDatabase(s.Database).(*store.Postgres)
+		if !ok {
+			return fmt.Errorf("rate limit backend %s requires a database", rateLimitPostgres)
+		}
+		s.limiter = db
+	default:
+		return fmt.Errorf("unknown rate limit backend %q", s.config.RateLimitBackend)
+	}
+
+	s.limits = limits
+	return nil
+}
+
+// rateLimitRefill возвращает наибольшее время заполнения корзины среди групп.
+// Корзины, не менявшиеся дольше, можно удалять.
+func (s *APIServer) rateLimitRefill() time.Duration {
+	var refill time.Duration
+	for _, limit := range s.limits {
+		if d := limit.Refill(); d > refill {
+			refill = d
+		}
+	}
+	return refill
+}
+
+// rateLimitKey возвращает ключ корзины: пользователя, если он зарегистрирован
+// или предъявил API ключ, иначе адрес клиента. Анонимный пользователь
+// может сбросить cookie и получить нового пользователя, поэтому
+// его запросы ограничиваются по адресу.
+func rateLimitKey(r *http.Request) string {
+	ctx := r.Context()
+	if id, ok := auth.UserIDFromContext(ctx); ok && (auth.IsRegistered(ctx) || auth.IsAPIKey(ctx)) {
+		return "user:" + strconv.Itoa(id)
+	}
+	return "ip:" + clientIP(r)
+}
+
+// rateLimit ограничивает частоту запросов группы маршрутов.
+// При превышении возвращается 429 с заголовком Retry-After в секундах.
+// Если ограничитель недоступен, запрос пропускается.
+func (s *APIServer) rateLimit(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := s.limits[group]
+			if s.limiter == nil || !limit.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := s.dbContext(r)
+			decision, err := s.limiter.Allow(ctx, group+":"+rateLimitKey(r), limit)
+			cancel()
+			if err != nil {
+				s.logger.Warnf("rate limit %s: %s", group, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !decision.Allowed {
+				retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+				if retryAfter < 1 {
+					retryAfter = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				s.writeError(w, r, newAPIError(http.StatusTooManyRequests, codeRateLimited,
+					"rate limit exceeded, retry in %s", time.Duration(retryAfter)*time.Second).
+					withDetail("retry_after", strconv.Itoa(retryAfter)))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// unwrapDatabase возвращает хранилище без обёрток вроде метрик.
+func unwrapDatabase(db store.Database) store.Database {
+	for {
+		wrapper, ok := db.(interface{ Unwrap() store.Database })
+		if !ok {
+			return db
+		}
+		db = wrapper.Unwrap()
+	}
+}
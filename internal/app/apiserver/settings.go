@@ -0,0 +1,228 @@
+package apiserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/codegen"
+)
+
+// setting параметр конфигурации. Ключ в файле конфигурации совпадает
+// с переменной окружения в нижнем регистре, длинный флаг — с ключом через дефис.
+type setting struct {
+	key string
+	// короткий флаг, оставленный для совместимости
+	short string
+	usage string
+	// секреты скрываются в -print-config
+	secret bool
+	value  func(c *Config) value
+}
+
+// value значение параметра, которое задаётся и выводится строкой.
+type value interface {
+	Set(s string) error
+	String() string
+}
+
+// env возвращает имя переменной окружения параметра.
+func (s setting) env() string {
+	return strings.ToUpper(s.key)
+}
+
+// flag возвращает имя длинного флага параметра.
+func (s setting) flag() string {
+	return strings.ReplaceAll(s.key, "_", "-")
+}
+
+// settings все параметры конфигурации.
+var settings = []setting{
+	{key: "server_address", short: "a", usage: "net address host:port", value: func(c *Config) value { return (*addrValue)(&c.bindAddr) }},
+	{key: "base_url", short: "b", usage: "base URL for short links", value: func(c *Config) value { return &c.BaseURL }},
+	{key: "file_storage_path", short: "f", usage: "file for URL storage", value: func(c *Config) value { return (*stringValue)(&c.FilePath) }},
+	{key: "database_dsn", short: "d", usage: "postgres connection string", secret: true, value: func(c *Config) value { return (*stringValue)(&c.databaseAddr) }},
+	{key: "log_level", usage: "log level", value: func(c *Config) value { return (*stringValue)(&c.LogLevel) }},
+	{key: "log_format", usage: "log format: text or json", value: func(c *Config) value { return (*stringValue)(&c.LogFormat) }},
+	{key: "log_redirect_sample", usage: "share of redirects written to the access log", value: func(c *Config) value { return (*floatValue)(&c.LogRedirectSample) }},
+	{key: "code_generator", short: "g", usage: "short code generator strategy: base62, random or hashids", value: func(c *Config) value { return (*stringValue)(&c.CodeGenerator) }},
+	{key: "code_length", usage: "length of random short codes", value: func(c *Config) value { return (*intValue)(&c.CodeLength) }},
+	{key: "code_salt", usage: "hashids salt", secret: true, value: func(c *Config) value { return (*stringValue)(&c.CodeSalt) }},
+	{key: "alias_charset", usage: "characters allowed in custom aliases", value: func(c *Config) value { return (*stringValue)(&c.AliasCharset) }},
+	{key: "alias_min_length", usage: "minimum custom alias length", value: func(c *Config) value { return (*intValue)(&c.AliasMinLen) }},
+	{key: "alias_max_length", usage: "maximum custom alias length", value: func(c *Config) value { return (*intValue)(&c.AliasMaxLen) }},
+	{key: "reserved_codes", usage: "comma separated codes reserved in addition to the built-in ones", value: func(c *Config) value {
+		return &listValue{list: &c.ReservedCodes, base: codegen.DefaultReserved}
+	}},
+	{key: "reap_interval", usage: "expired URL cleanup interval", value: func(c *Config) value { return (*durationValue)(&c.ReapInterval) }},
+	{key: "worker_batch_interval", usage: "interval between delete and click batches", value: func(c *Config) value { return (*durationValue)(&c.WorkerBatchInterval) }},
+	{key: "db_timeout", usage: "storage timeout per request", value: func(c *Config) value { return (*durationValue)(&c.DBTimeout) }},
+	{key: "shutdown_timeout", usage: "graceful shutdown timeout", value: func(c *Config) value { return (*durationValue)(&c.ShutdownTimeout) }},
+	{key: "jwt_secret", usage: "HS256 token secret", secret: true, value: func(c *Config) value { return (*stringValue)(&c.JWTSecret) }},
+	{key: "jwt_secret_file", usage: "file with the token secret or PEM private key", value: func(c *Config) value { return (*stringValue)(&c.JWTSecretFile) }},
+	{key: "jwt_algorithm", usage: "token signing algorithm: HS256, RS256 or EdDSA", value: func(c *Config) value { return (*stringValue)(&c.JWTAlgorithm) }},
+	{key: "jwt_key_id", usage: "active signing key id", value: func(c *Config) value { return (*stringValue)(&c.JWTKeyID) }},
+	{key: "jwt_previous_keys", usage: "comma separated verification keys kid:alg:path", value: func(c *Config) value { return &listValue{list: &c.JWTPreviousKeys} }},
+	{key: "token_exp", usage: "token lifetime", value: func(c *Config) value { return (*durationValue)(&c.TokenExp) }},
+	{key: "token_refresh_before", usage: "refresh tokens this long before expiry", value: func(c *Config) value { return (*durationValue)(&c.TokenRefreshBefore) }},
+	{key: "rate_limit_create", usage: "create rate limit N/s, N/m, N/h or off", value: func(c *Config) value { return (*stringValue)(&c.RateLimitCreate) }},
+	{key: "rate_limit_redirect", usage: "redirect rate limit N/s, N/m, N/h or off", value: func(c *Config) value { return (*stringValue)(&c.RateLimitRedirect) }},
+	{key: "rate_limit_delete", usage: "delete rate limit N/s, N/m, N/h or off", value: func(c *Config) value { return (*stringValue)(&c.RateLimitDelete) }},
+	{key: "rate_limit_backend", usage: "rate limit backend: memory or postgres", value: func(c *Config) value { return (*stringValue)(&c.RateLimitBackend) }},
+	{key: "url_allowed_schemes", usage: "comma separated allowed URL schemes", value: func(c *Config) value { return &listValue{list: &c.URLAllowedSchemes} }},
+	{key: "url_default_scheme", usage: "scheme for URLs without one, off disables it", value: func(c *Config) value { return (*schemeValue)(&c.URLDefaultScheme) }},
+	{key: "url_max_length", usage: "maximum URL length", value: func(c *Config) value { return (*intValue)(&c.URLMaxLength) }},
+	{key: "max_body_size", usage: "maximum request body size in bytes", value: func(c *Config) value { return (*int64Value)(&c.MaxBodySize) }},
+	{key: "url_blocklist_file", usage: "URL blocklist file", value: func(c *Config) value { return (*stringValue)(&c.URLBlocklistFile) }},
+	{key: "url_blocklist_reload", usage: "blocklist reload interval", value: func(c *Config) value { return (*durationValue)(&c.URLBlocklistReload) }},
+	{key: "url_policy_endpoint", usage: "URL reputation service endpoint", value: func(c *Config) value { return (*stringValue)(&c.URLPolicyEndpoint) }},
+	{key: "url_policy_timeout", usage: "URL reputation service timeout", value: func(c *Config) value { return (*durationValue)(&c.URLPolicyTimeout) }},
+	{key: "url_policy_cache_ttl", usage: "URL reputation cache TTL", value: func(c *Config) value { return (*durationValue)(&c.URLPolicyCacheTTL) }},
+	{key: "url_policy_fail_open", usage: "allow URLs when the reputation service is unavailable", value: func(c *Config) value { return (*boolValue)(&c.URLPolicyFailOpen) }},
+	{key: "blocked_redirect_status", usage: "status for blocked redirects: 451 or 410", value: func(c *Config) value { return (*intValue)(&c.BlockedRedirectStatus) }},
+	{key: "metrics_enabled", usage: "serve Prometheus metrics on /metrics", value: func(c *Config) value { return (*boolValue)(&c.MetricsEnabled) }},
+	{key: "tracing_exporter", usage: "trace exporter: none, stdout or otlp", value: func(c *Config) value { return (*stringValue)(&c.TracingExporter) }},
+	{key: "tracing_endpoint", usage: "OTLP/HTTP collector endpoint", value: func(c *Config) value { return (*stringValue)(&c.TracingEndpoint) }},
+	{key: "tracing_sample_ratio", usage: "share of traces recorded", value: func(c *Config) value { return (*floatValue)(&c.TracingSampleRatio) }},
+	{key: "service_name", usage: "service name in traces", value: func(c *Config) value { return (*stringValue)(&c.ServiceName) }},
+	{key: "analytics_salt", usage: "salt for client address hashes", secret: true, value: func(c *Config) value { return (*stringValue)(&c.AnalyticsSalt) }},
+}
+
+// lookupSetting ищет параметр по ключу.
+func lookupSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type int64Value int64
+
+func (v *int64Value) Set(s string) error {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", s)
+	}
+	*v = int64Value(n)
+	return nil
+}
+
+func (v *int64Value) String() string { return strconv.FormatInt(int64(*v), 10) }
+
+type floatValue float64
+
+func (v *floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", s)
+	}
+	*v = floatValue(f)
+	return nil
+}
+
+func (v *floatValue) String() string { return strconv.FormatFloat(float64(*v), 'g', -1, 64) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a boolean", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+
+// IsBoolFlag позволяет задавать флаг без значения.
+func (v *boolValue) IsBoolFlag() bool { return true }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+// listValue список через запятую. Значения добавляются к base.
+type listValue struct {
+	list *[]string
+	base []string
+}
+
+func (v *listValue) Set(s string) error {
+	list := append([]string{}, v.base...)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*v.list = list
+	return nil
+}
+
+func (v *listValue) String() string {
+	if len(*v.list) < len(v.base) {
+		return strings.Join(*v.list, ",")
+	}
+	return strings.Join((*v.list)[len(v.base):], ",")
+}
+
+// schemeValue схема по умолчанию, off отключает её подстановку.
+type schemeValue string
+
+func (v *schemeValue) Set(s string) error {
+	if s == "off" {
+		s = ""
+	}
+	*v = schemeValue(s)
+	return nil
+}
+
+func (v *schemeValue) String() string {
+	if *v == "" {
+		return "off"
+	}
+	return string(*v)
+}
+
+// addrValue адрес вида host:port.
+type addrValue string
+
+func (v *addrValue) Set(s string) error {
+	if err := new(NetAddress).Set(s); err != nil {
+		return fmt.Errorf("%q: %w", s, err)
+	}
+	*v = addrValue(s)
+	return nil
+}
+
+func (v *addrValue) String() string { return string(*v) }
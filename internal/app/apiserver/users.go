@@ -0,0 +1,169 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/auth"
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ограничения на учётные данные, bcrypt учитывает только первые 72 байта пароля
+const (
+	maxLoginLength    = 64
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// хеш для сравнения при неизвестном логине, чтобы время ответа
+// не выдавало существование пользователя
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// учётные данные для JSON объекта
+type credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// результат входа для JSON объекта
+type accountResult struct {
+	UserID      int `json:"user_id"`
+	ClaimedURLs int `json:"claimed_urls"`
+}
+
+// validate проверяет учётные данные при регистрации.
+func (c credentials) validate() error {
+	switch {
+	case len(strings.TrimSpace(c.Login)) == 0:
+		return errors.New("login is required")
+	case len(c.Login) > maxLoginLength:
+		return errors.New("login is too long")
+	case len(c.Password) < minPasswordLength:
+		return errors.New("password is too short")
+	case len(c.Password) > maxPasswordLength:
+		return errors.New("password is too long")
+	}
+	return nil
+}
+
+// readCredentials читает JSON объект {"login":"<login>","password":"<password>"}.
+func readCredentials(r *http.Request) (credentials, *apiError) {
+	var creds credentials
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return creds, bodyError(err)
+	}
+	if err := json.Unmarshal(body, &creds); err != nil {
+		return creds, jsonError(err)
+	}
+	return creds, nil
+}
+
+// Register регистрирует пользователя по логину и паролю.
+// Ссылки, созданные в текущей анонимной сессии, переходят к новому пользователю.
+func (s *APIServer) Register(w http.ResponseWriter, r *http.Request) {
+	creds, apiErr := readCredentials(r)
+	if apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+	if err := creds.validate(); err != nil {
+		s.writeError(w, r, badRequestError("%s", err))
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
+	if err != nil {
+		s.writeError(w, r, internalError(err))
+		return
+	}
+
+	ctx, cancel := s.dbContext(r)
+	defer cancel()
+
+	id, err := s.users.NextUserID(ctx)
+	if err != nil {
+		s.writeError(w, r, storageError(err))
+		return
+	}
+
+	user := &store.User{ID: id, Login: creds.Login, PasswordHash: hash}
+	if err := s.accounts.CreateUser(ctx, user); err != nil {
+		if errors.Is(err, store.ErrUserExists) {
+			s.writeError(w, r, newAPIError(http.StatusConflict, codeUserExists, "%s", err))
+			return
+		}
+		s.writeError(w, r, storageError(err))
+		return
+	}
+
+	s.signIn(w, r, user.ID, http.StatusCreated)
+}
+
+// Login выполняет вход по логину и паролю.
+// Ссылки, созданные в текущей анонимной сессии, переходят к пользователю.
+func (s *APIServer) Login(w http.ResponseWriter, r *http.Request) {
+	creds, apiErr := readCredentials(r)
+	if apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+
+	ctx, cancel := s.dbContext(r)
+	defer cancel()
+
+	user, err := s.accounts.UserByLogin(ctx, creds.Login)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		s.writeError(w, r, storageError(err))
+		return
+	}
+
+	hash := user.PasswordHash
+	if err != nil {
+		hash = dummyHash
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(creds.Password)) != nil || err != nil {
+		s.writeError(w, r, newAPIError(http.StatusUnauthorized, codeInvalidCredentials, "invalid login or password"))
+		return
+	}
+
+	s.signIn(w, r, user.ID, http.StatusOK)
+}
+
+// signIn передаёт пользователю ссылки анонимной сессии и выдаёт токен.
+func (s *APIServer) signIn(w http.ResponseWriter, r *http.Request, id, status int) {
+	ctx, cancel := s.dbContext(r)
+	defer cancel()
+
+	// ссылки зарегистрированного пользователя хранилище не передаёт
+	claimed := 0
+	if anonymous, ok := auth.UserIDFromContext(r.Context()); ok {
+		var err error
+		claimed, err = s.accounts.ClaimURLs(ctx, anonymous, id)
+		if err != nil {
+			s.writeError(w, r, storageError(err))
+			return
+		}
+	}
+
+	token, err := s.keys.SignRegistered(id)
+	if err != nil {
+		s.writeError(w, r, internalError(err))
+		return
+	}
+	s.setTokenCookie(w, token)
+
+	objectJSON, err := json.Marshal(accountResult{UserID: id, ClaimedURLs: claimed})
+	if err != nil {
+		s.writeError(w, r, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(objectJSON)
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Области действия API ключей.
+const (
+	// чтение своих ссылок и статистики
+	ScopeRead = "read"
+	// сокращение ссылок
+	ScopeShorten = "shorten"
+	// удаление своих ссылок
+	ScopeDelete = "delete"
+)
+
+// AllScopes области действия ключа без ограничений.
+var AllScopes = []string{ScopeRead, ScopeShorten, ScopeDelete}
+
+var ErrUnknownScope = errors.New("unknown scope")
+
+// ValidateScopes проверяет области действия ключа.
+// Пустой список означает ключ без ограничений.
+func ValidateScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return AllScopes, nil
+	}
+
+	seen := make(map[string]struct{}, len(scopes))
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeRead, ScopeShorten, ScopeDelete:
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownScope, scope)
+		}
+		if _, ok := seen[scope]; ok {
+			continue
+		}
+		seen[scope] = struct{}{}
+		result = append(result, scope)
+	}
+	return result, nil
+}
+
+// NewAPIKey создаёт API ключ вида <id>.<secret>.
+// Идентификатор открытый и нужен для отзыва, ключ целиком показывается только один раз.
+func NewAPIKey() (id, key string, err error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", fmt.Errorf("error from auth. can't generate api key - %w", err)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("error from auth. can't generate api key - %w", err)
+	}
+
+	id = hex.EncodeToString(idBytes)
+	return id, id + "." + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// HashAPIKey возвращает хеш ключа для хранения и поиска.
+// Ключ содержит 256 бит случайных данных, поэтому медленный хеш не нужен.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
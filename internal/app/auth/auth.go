@@ -11,53 +11,131 @@ import (
 type Claims struct {
 	jwt.RegisteredClaims
 	UserID int
+	// пользователь зарегистрирован, а не выдан анонимной сессии
+	Registered bool `json:",omitempty"`
 }
 
-var (
-	ID       = 1
-	ErrToken = errors.New("token is not valid")
-)
+var ErrToken = errors.New("token is not valid")
 
-const tokenExp = time.Hour * 3
-const secretKey = "yandex"
+// Options настройки выдачи токенов.
+type Options struct {
+	// срок жизни токена
+	TokenExp time.Duration
+	// токен перевыпускается, если до истечения осталось меньше RefreshBefore
+	RefreshBefore time.Duration
+}
 
-// ChangeID инициализирует и меняет ID для базы данных.
-func ChangeID(newID int) {
-	ID = newID
-	ID++
+// Keyring подписывает токены активным ключом и проверяет их
+// активным и предыдущими ключами, что позволяет менять ключи без разлогина.
+type Keyring struct {
+	opts   Options
+	active *Key
+	keys   map[string]*Key
 }
 
-// BuildJWTString создает токен.
-func BuildJWTString() (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExp)),
-		},
-		UserID: ID,
-	})
+// NewKeyring возвращает набор ключей. Активный ключ должен уметь подписывать.
+func NewKeyring(opts Options, active *Key, previous ...*Key) (*Keyring, error) {
+	if active == nil || !active.CanSign() {
+		return nil, fmt.Errorf("%w: active key must have a private part", ErrInvalidKey)
+	}
+
+	keys := map[string]*Key{active.ID: active}
+	for _, key := range previous {
+		if _, ok := keys[key.ID]; ok {
+			return nil, fmt.Errorf("%w: duplicate kid %s", ErrInvalidKey, key.ID)
+		}
+		keys[key.ID] = key
+	}
+
+	return &Keyring{
+		opts:   opts,
+		active: active,
+		keys:   keys,
+	}, nil
+}
 
-	tokenString, err := token.SignedString([]byte(secretKey))
+// Sign создает токен для анонимного пользователя userID, подписанный активным ключом.
+func (k *Keyring) Sign(userID int) (string, error) {
+	return k.sign(Claims{UserID: userID})
+}
+
+// SignRegistered создает токен для зарегистрированного пользователя userID.
+func (k *Keyring) SignRegistered(userID int) (string, error) {
+	return k.sign(Claims{UserID: userID, Registered: true})
+}
+
+func (k *Keyring) sign(claims Claims) (string, error) {
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(k.opts.TokenExp))
+	token := jwt.NewWithClaims(k.active.method, claims)
+	token.Header["kid"] = k.active.ID
+
+	tokenString, err := token.SignedString(k.active.sign)
 	if err != nil {
 		return "", fmt.Errorf("error from auth - %s", err)
 	}
-
-	ID++
 	return tokenString, nil
 }
 
-// GetUserID проверяет токен.
-func GetUserID(tokenString string) (int, error) {
+// Parse проверяет токен и возвращает его claims.
+// Токен без kid проверяется активным ключом.
+func (k *Keyring) Parse(tokenString string) (*Claims, error) {
+	_, claims, err := k.parse(tokenString)
+	return claims, err
+}
+
+func (k *Keyring) parse(tokenString string) (*Key, *Claims, error) {
 	claims := &Claims{}
+	var used *Key
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
+		key := k.active
+		if kid, ok := t.Header["kid"]; ok {
+			id, _ := kid.(string)
+			if key, ok = k.keys[id]; !ok {
+				return nil, fmt.Errorf("unknown kid %v", kid)
+			}
+		}
+
+		// алгоритм задаёт ключ, а не заголовок токена
+		if t.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		used = key
+		return key.verify, nil
 	})
 	if err != nil {
-		return -1, fmt.Errorf("error from auth - %s", err)
+		return nil, nil, fmt.Errorf("error from auth - %s", err)
 	}
 
 	if !token.Valid {
-		return -1, ErrToken
+		return nil, nil, ErrToken
 	}
 
+	return used, claims, nil
+}
+
+// GetUserID проверяет токен.
+func (k *Keyring) GetUserID(tokenString string) (int, error) {
+	claims, err := k.Parse(tokenString)
+	if err != nil {
+		return -1, err
+	}
 	return claims.UserID, nil
 }
+
+// NeedsRefresh проверяет токен и сообщает, что его пора перевыпустить:
+// он скоро истечёт или подписан одним из предыдущих ключей.
+// Для недействительного токена возвращается ошибка.
+func (k *Keyring) NeedsRefresh(tokenString string, now time.Time) (*Claims, bool, error) {
+	key, claims, err := k.parse(tokenString)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if key != k.active {
+		return claims, true, nil
+	}
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Sub(now) < k.opts.RefreshBefore {
+		return claims, true, nil
+	}
+	return claims, false, nil
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+var testOptions = Options{TokenExp: time.Hour, RefreshBefore: 10 * time.Minute}
+
+func newHMACKeyring(t *testing.T, id, secret string, previous ...*Key) *Keyring {
+	t.Helper()
+
+	key, err := LoadKey(id, AlgHS256, []byte(secret))
+	require.NoError(t, err)
+	keys, err := NewKeyring(testOptions, key, previous...)
+	require.NoError(t, err)
+	return keys
+}
+
+func TestSignAndParse(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	edPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER})
+
+	tests := []struct {
+		alg  string
+		data []byte
+	}{
+		{AlgHS256, []byte(testSecret + "\n")},
+		{AlgRS256, rsaPEM},
+		{AlgEdDSA, edPEM},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.alg, func(t *testing.T) {
+			key, err := LoadKey("k1", tc.alg, tc.data)
+			require.NoError(t, err)
+			keys, err := NewKeyring(testOptions, key)
+			require.NoError(t, err)
+
+			token, err := keys.Sign(42)
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, "k1", parsed.Header["kid"])
+			assert.Equal(t, tc.alg, parsed.Method.Alg())
+
+			claims, err := keys.Parse(token)
+			require.NoError(t, err)
+			assert.Equal(t, 42, claims.UserID)
+			assert.False(t, claims.Registered)
+
+			token, err = keys.SignRegistered(42)
+			require.NoError(t, err)
+			claims, err = keys.Parse(token)
+			require.NoError(t, err)
+			assert.Equal(t, 42, claims.UserID)
+			assert.True(t, claims.Registered)
+		})
+	}
+}
+
+func TestLoadKeyErrors(t *testing.T) {
+	_, err := LoadKey("k1", AlgHS256, []byte("short"))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = LoadKey("k1", "none", []byte(testSecret))
+	assert.ErrorIs(t, err, ErrUnknownAlgorithm)
+
+	_, err = LoadKey("k1", AlgRS256, []byte(testSecret))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = LoadKey("", AlgHS256, []byte(testSecret))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := newHMACKeyring(t, "old", testSecret)
+	oldToken, err := old.Sign(7)
+	require.NoError(t, err)
+
+	previous, err := LoadKey("old", AlgHS256, []byte(testSecret))
+	require.NoError(t, err)
+	current := newHMACKeyring(t, "new", strings.Repeat("n", 32), previous)
+
+	// токен от предыдущего ключа принимается и перевыпускается
+	claims, refresh, err := current.NeedsRefresh(oldToken, time.Now())
+	require.NoError(t, err)
+	assert.True(t, refresh)
+	assert.Equal(t, 7, claims.UserID)
+
+	newToken, err := current.Sign(claims.UserID)
+	require.NoError(t, err)
+	_, refresh, err = current.NeedsRefresh(newToken, time.Now())
+	require.NoError(t, err)
+	assert.False(t, refresh)
+
+	// после удаления предыдущего ключа старый токен недействителен
+	withoutOld := newHMACKeyring(t, "new", strings.Repeat("n", 32))
+	_, err = withoutOld.GetUserID(oldToken)
+	assert.Error(t, err)
+	id, err := withoutOld.GetUserID(newToken)
+	require.NoError(t, err)
+	assert.Equal(t, 7, id)
+}
+
+func TestNeedsRefreshNearExpiry(t *testing.T) {
+	keys := newHMACKeyring(t, "k1", testSecret)
+	token, err := keys.Sign(1)
+	require.NoError(t, err)
+
+	_, refresh, err := keys.NeedsRefresh(token, time.Now())
+	require.NoError(t, err)
+	assert.False(t, refresh)
+
+	_, refresh, err = keys.NeedsRefresh(token, time.Now().Add(55*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, refresh)
+}
+
+func TestParseRejectsForgedTokens(t *testing.T) {
+	keys := newHMACKeyring(t, "k1", testSecret)
+
+	// подпись другим секретом с тем же kid
+	forged := newHMACKeyring(t, "k1", strings.Repeat("x", 32))
+	token, err := forged.Sign(1)
+	require.NoError(t, err)
+	_, err = keys.GetUserID(token)
+	assert.Error(t, err)
+
+	// неизвестный kid
+	unknown := newHMACKeyring(t, "k2", testSecret)
+	token, err = unknown.Sign(1)
+	require.NoError(t, err)
+	_, err = keys.GetUserID(token)
+	assert.Error(t, err)
+
+	// алгоритм none не принимается
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, Claims{UserID: 1})
+	none.Header["kid"] = "k1"
+	token, err = none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = keys.GetUserID(token)
+	assert.Error(t, err)
+}
+
+func TestValidateScopes(t *testing.T) {
+	scopes, err := ValidateScopes(nil)
+	require.NoError(t, err)
+	assert.Equal(t, AllScopes, scopes)
+
+	scopes, err = ValidateScopes([]string{ScopeRead, ScopeRead, ScopeShorten})
+	require.NoError(t, err)
+	assert.Equal(t, []string{ScopeRead, ScopeShorten}, scopes)
+
+	_, err = ValidateScopes([]string{"admin"})
+	assert.ErrorIs(t, err, ErrUnknownScope)
+}
+
+func TestNewAPIKey(t *testing.T) {
+	id, key, err := NewAPIKey()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, id+"."))
+
+	_, other, err := NewAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+	assert.NotEqual(t, HashAPIKey(key), HashAPIKey(other))
+	assert.Equal(t, HashAPIKey(key), HashAPIKey(key))
+}
+
+func TestLazyUserID(t *testing.T) {
+	calls := 0
+	fail := true
+	ctx := WithLazyUserID(context.Background(), func() (int, error) {
+		calls++
+		if fail {
+			return 0, errors.New("storage is down")
+		}
+		return 7, nil
+	})
+
+	// без обращения пользователь не создаётся
+	_, ok := UserIDFromContext(ctx)
+	assert.False(t, ok)
+	assert.Zero(t, calls)
+
+	// неудачная попытка повторяется при следующем обращении
+	_, err := UserID(ctx)
+	require.Error(t, err)
+	fail = false
+	for i := 0; i < 2; i++ {
+		id, err := UserID(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 7, id)
+	}
+	assert.Equal(t, 2, calls)
+
+	id, ok := UserIDFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, 7, id)
+
+	_, err = UserID(context.Background())
+	assert.ErrorIs(t, err, ErrNoUser)
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrNoUser = errors.New("user is not defined")
+
+// userIDKey ключ идентификатора пользователя в контексте запроса.
+type userIDKey struct{}
+
+// lazyUserKey ключ пользователя, который создаётся при первом обращении.
+type lazyUserKey struct{}
+
+// lazyUser пользователь, идентификатор которого выдаётся только по требованию.
+// Если выдать его не удалось, следующее обращение пробует снова.
+type lazyUser struct {
+	mu      sync.Mutex
+	alloc   func() (int, error)
+	id      int
+	created bool
+}
+
+// WithUserID возвращает копию ctx с идентификатором пользователя.
+func WithUserID(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, userIDKey{}, id)
+}
+
+// WithLazyUserID возвращает копию ctx, в которой пользователь создаётся
+// функцией alloc при первом вызове UserID.
+func WithLazyUserID(ctx context.Context, alloc func() (int, error)) context.Context {
+	return context.WithValue(ctx, lazyUserKey{}, &lazyUser{alloc: alloc})
+}
+
+// UserID возвращает идентификатор пользователя из ctx и при необходимости создаёт его.
+// Если пользователь не определён и не может быть создан, возвращается ErrNoUser.
+func UserID(ctx context.Context) (int, error) {
+	if id, ok := ctx.Value(userIDKey{}).(int); ok {
+		return id, nil
+	}
+
+	lazy, ok := ctx.Value(lazyUserKey{}).(*lazyUser)
+	if !ok {
+		return 0, ErrNoUser
+	}
+
+	lazy.mu.Lock()
+	defer lazy.mu.Unlock()
+	if !lazy.created {
+		id, err := lazy.alloc()
+		if err != nil {
+			return 0, err
+		}
+		lazy.id, lazy.created = id, true
+	}
+	return lazy.id, nil
+}
+
+// UserIDFromContext возвращает идентификатор пользователя из ctx, не создавая его.
+// Если пользователь не определён или ещё не создан, ok равно false.
+func UserIDFromContext(ctx context.Context) (id int, ok bool) {
+	if id, ok = ctx.Value(userIDKey{}).(int); ok {
+		return id, true
+	}
+
+	lazy, ok := ctx.Value(lazyUserKey{}).(*lazyUser)
+	if !ok {
+		return 0, false
+	}
+	lazy.mu.Lock()
+	defer lazy.mu.Unlock()
+	return lazy.id, lazy.created
+}
+
+// registeredKey признак зарегистрированного пользователя в контексте запроса.
+type registeredKey struct{}
+
+// WithRegistered возвращает копию ctx, в которой пользователь отмечен зарегистрированным.
+func WithRegistered(ctx context.Context) context.Context {
+	return context.WithValue(ctx, registeredKey{}, true)
+}
+
+// IsRegistered сообщает, что пользователь запроса зарегистрирован.
+func IsRegistered(ctx context.Context) bool {
+	registered, _ := ctx.Value(registeredKey{}).(bool)
+	return registered
+}
+
+// scopesKey ключ областей действия API ключа в контексте запроса.
+type scopesKey struct{}
+
+// WithScopes возвращает копию ctx с областями действия API ключа.
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+// HasScope сообщает, разрешена ли запросу область scope.
+// Запросы с токеном из cookie не ограничены.
+func HasScope(ctx context.Context, scope string) bool {
+	scopes, ok := ctx.Value(scopesKey{}).([]string)
+	if !ok {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAPIKey сообщает, что запрос выполнен с API ключом.
+func IsAPIKey(ctx context.Context) bool {
+	_, ok := ctx.Value(scopesKey{}).([]string)
+	return ok
+}
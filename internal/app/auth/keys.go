@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Поддерживаемые алгоритмы подписи.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// минимальная длина секрета для HS256
+const minSecretLength = 32
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown signing algorithm")
+	ErrInvalidKey       = errors.New("invalid signing key")
+)
+
+// Key ключ подписи токенов с идентификатором kid.
+// Ключ без закрытой части годится только для проверки подписи.
+type Key struct {
+	ID     string
+	method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+// CanSign сообщает, можно ли подписывать токены этим ключом.
+func (k *Key) CanSign() bool {
+	return k.sign != nil
+}
+
+// LoadKey создаёт ключ алгоритма alg из data.
+// Для HS256 data — сам секрет, для RS256 и EdDSA — закрытый или открытый ключ в PEM.
+func LoadKey(id, alg string, data []byte) (*Key, error) {
+	if id == "" {
+		return nil, fmt.Errorf("%w: empty kid", ErrInvalidKey)
+	}
+
+	switch alg {
+	case AlgHS256:
+		return NewHMACKey(id, bytes.TrimSpace(data))
+	case AlgRS256, AlgEdDSA:
+		return newPEMKey(id, alg, data)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, alg)
+	}
+}
+
+// NewHMACKey создаёт ключ HS256.
+func NewHMACKey(id string, secret []byte) (*Key, error) {
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("%w: HS256 secret must be at least %d bytes", ErrInvalidKey, minSecretLength)
+	}
+	return &Key{
+		ID:     id,
+		method: jwt.SigningMethodHS256,
+		sign:   secret,
+		verify: secret,
+	}, nil
+}
+
+// newPEMKey разбирает ключ RS256 или EdDSA в формате PEM.
+func newPEMKey(id, alg string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %s key %s is not PEM encoded", ErrInvalidKey, alg, id)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: unsupported PEM block %q", ErrInvalidKey, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKey, err)
+	}
+
+	key := &Key{ID: id}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.sign, key.verify = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.verify = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.sign, key.verify = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.verify = jwt.SigningMethodEdDSA, crypto.PublicKey(k)
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidKey, parsed)
+	}
+
+	if key.method.Alg() != alg {
+		return nil, fmt.Errorf("%w: key %s is %s, not %s", ErrInvalidKey, id, key.method.Alg(), alg)
+	}
+	return key, nil
+}
@@ -0,0 +1,56 @@
+package codegen
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultAliasCharset символы, допустимые в пользовательском коде по умолчанию.
+const DefaultAliasCharset = base62Alphabet + "-_"
+
+// DefaultReserved коды, совпадающие с маршрутами сервиса.
+var DefaultReserved = []string{"api", "ping", "metrics"}
+
+var (
+	ErrInvalidAlias  = errors.New("invalid alias")
+	ErrReservedAlias = errors.New("alias is reserved")
+)
+
+// AliasRules правила проверки пользовательских кодов.
+type AliasRules struct {
+	Charset   string
+	MinLength int
+	MaxLength int
+	Reserved  []string
+}
+
+// Validate проверяет пользовательский код на соответствие правилам.
+func (r AliasRules) Validate(alias string) error {
+	if n := utf8.RuneCountInString(alias); n < r.MinLength || n > r.MaxLength {
+		return fmt.Errorf("%w: length must be between %d and %d", ErrInvalidAlias, r.MinLength, r.MaxLength)
+	}
+
+	for _, c := range alias {
+		if !strings.ContainsRune(r.Charset, c) {
+			return fmt.Errorf("%w: character %q is not allowed", ErrInvalidAlias, c)
+		}
+	}
+
+	if isReserved(alias, r.Reserved) {
+		return fmt.Errorf("%w: %s", ErrReservedAlias, alias)
+	}
+
+	return nil
+}
+
+// isReserved проверяет код по списку зарезервированных без учёта регистра.
+func isReserved(code string, reserved []string) bool {
+	for _, word := range reserved {
+		if strings.EqualFold(code, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+// Package codegen формирует короткие коды для сокращённых ссылок.
+package codegen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+)
+
+// Названия стратегий генерации кодов.
+const (
+	StrategyBase62  = "base62"
+	StrategyRandom  = "random"
+	StrategyHashids = "hashids"
+)
+
+const base62Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+var (
+	ErrUnknownStrategy = errors.New("unknown code generator strategy")
+	ErrExhausted       = errors.New("can't generate unique code")
+)
+
+// Generator формирует новый, ещё не занятый в хранилище короткий код.
+type Generator interface {
+	Generate(ctx context.Context) (string, error)
+}
+
+// Options настройки генератора.
+type Options struct {
+	Strategy string
+	Length   int
+	Salt     string
+	Reserved []string
+}
+
+// New возвращает генератор выбранной стратегии.
+// Зарезервированные коды генератор никогда не выдаёт.
+func New(opts Options, db store.Database) (Generator, error) {
+	var gen Generator
+	switch opts.Strategy {
+	case "", StrategyBase62:
+		gen = NewBase62(db)
+	case StrategyRandom:
+		random, err := NewRandom(db, opts.Length)
+		if err != nil {
+			return nil, err
+		}
+		gen = random
+	case StrategyHashids:
+		gen = NewHashids(db, opts.Salt, opts.Length)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStrategy, opts.Strategy)
+	}
+
+	if len(opts.Reserved) == 0 {
+		return gen, nil
+	}
+	return &skipReserved{next: gen, reserved: opts.Reserved}, nil
+}
+
+// skipReserved пропускает зарезервированные коды.
+type skipReserved struct {
+	next     Generator
+	reserved []string
+}
+
+func (g *skipReserved) Generate(ctx context.Context) (string, error) {
+	for {
+		code, err := g.next.Generate(ctx)
+		if err != nil {
+			return "", err
+		}
+		if !isReserved(code, g.reserved) {
+			return code, nil
+		}
+	}
+}
+
+// exists проверяет, занят ли код в хранилище.
+func exists(ctx context.Context, db store.Database, code string) (bool, error) {
+	var url store.URL
+	err := db.ReadURL(ctx, &url, code)
+	switch {
+	case err == nil, errors.Is(err, store.ErrDeleted), errors.Is(err, store.ErrExpired):
+		return true, nil
+	case errors.Is(err, store.ErrNotFound):
+		return false, nil
+	default:
+		return false, fmt.Errorf("error from codegen. can't check code - %w", err)
+	}
+}
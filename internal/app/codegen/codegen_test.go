@@ -0,0 +1,102 @@
+package codegen
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/memorystorage"
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBase62SkipsTakenCodes(t *testing.T) {
+	db := memorystorage.NewMemoryStorage()
+	require.NoError(t, db.WriteURL(context.Background(), store.NewURL("2", "http://example.com", 1)))
+
+	gen := NewBase62(db)
+	var codes []string
+	for i := 0; i < 3; i++ {
+		code, err := gen.Generate(context.Background())
+		require.NoError(t, err)
+		codes = append(codes, code)
+	}
+
+	assert.Equal(t, []string{"1", "3", "4"}, codes)
+}
+
+// TestBase62SharedCounter проверяет, что генераторы с общим хранилищем,
+// как у нескольких экземпляров сервиса, не выдают одинаковые коды.
+func TestBase62SharedCounter(t *testing.T) {
+	db := memorystorage.NewMemoryStorage()
+	first, second := NewBase62(db), NewBase62(db)
+
+	seen := make(map[string]struct{})
+	for i := 0; i < 10; i++ {
+		for _, gen := range []*Sequence{first, second} {
+			code, err := gen.Generate(context.Background())
+			require.NoError(t, err)
+			assert.NotContains(t, seen, code)
+			seen[code] = struct{}{}
+		}
+	}
+}
+
+func TestEncodeBase62(t *testing.T) {
+	assert.Equal(t, "1", encodeBase62(1))
+	assert.Equal(t, "a", encodeBase62(10))
+	assert.Equal(t, "Z", encodeBase62(61))
+	assert.Equal(t, "10", encodeBase62(62))
+}
+
+func TestHashidsUnique(t *testing.T) {
+	h := newHashids("salt", 6)
+	seen := make(map[string]uint64)
+	for n := uint64(1); n <= 10000; n++ {
+		code := h.encode(n)
+		assert.GreaterOrEqual(t, len(code), 6)
+		prev, ok := seen[code]
+		require.False(t, ok, "code %s for %d and %d", code, prev, n)
+		seen[code] = n
+	}
+
+	assert.NotEqual(t, newHashids("other", 6).encode(1), h.encode(1))
+}
+
+func TestRandom(t *testing.T) {
+	gen, err := NewRandom(memorystorage.NewMemoryStorage(), 10)
+	require.NoError(t, err)
+
+	code, err := gen.Generate(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, code, 10)
+}
+
+func TestNewUnknownStrategy(t *testing.T) {
+	_, err := New(Options{Strategy: "unknown"}, memorystorage.NewMemoryStorage())
+	assert.ErrorIs(t, err, ErrUnknownStrategy)
+}
+
+func TestAliasRulesValidate(t *testing.T) {
+	rules := AliasRules{
+		Charset:   DefaultAliasCharset,
+		MinLength: 3,
+		MaxLength: 16,
+		Reserved:  DefaultReserved,
+	}
+
+	assert.NoError(t, rules.Validate("spring-sale"))
+	assert.ErrorIs(t, rules.Validate("ab"), ErrInvalidAlias)
+	assert.ErrorIs(t, rules.Validate("a-very-long-alias-name"), ErrInvalidAlias)
+	assert.ErrorIs(t, rules.Validate("api/shorten"), ErrInvalidAlias)
+	assert.ErrorIs(t, rules.Validate("PING"), ErrReservedAlias)
+}
+
+func TestNewSkipsReserved(t *testing.T) {
+	gen, err := New(Options{Strategy: StrategyBase62, Reserved: []string{"1"}}, memorystorage.NewMemoryStorage())
+	require.NoError(t, err)
+
+	code, err := gen.Generate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "2", code)
+}
@@ -0,0 +1,54 @@
+package codegen
+
+import "strings"
+
+// hashids кодирует числа по мотивам алгоритма Hashids.
+type hashids struct {
+	alphabet  []byte
+	salt      []byte
+	minLength int
+}
+
+func newHashids(salt string, minLength int) *hashids {
+	return &hashids{
+		alphabet:  shuffle([]byte(base62Alphabet), []byte(salt)),
+		salt:      []byte(salt),
+		minLength: minLength,
+	}
+}
+
+// encode возвращает код для числа n. Первый символ («лотерея») определяет
+// перестановку алфавита для остальной части кода, поэтому соседние числа
+// дают непохожие коды, а разные числа — разные коды.
+func (h *hashids) encode(n uint64) string {
+	lottery := h.alphabet[n%uint64(len(h.alphabet))]
+
+	key := make([]byte, 0, len(h.salt)+1)
+	key = append(key, lottery)
+	key = append(key, h.salt...)
+	alphabet := shuffle(h.alphabet, key)
+
+	body := encode(n, alphabet)
+	if pad := h.minLength - 1 - len(body); pad > 0 {
+		body = strings.Repeat(string(alphabet[0]), pad) + body
+	}
+
+	return string(lottery) + body
+}
+
+// shuffle детерминированно перемешивает алфавит по соли.
+func shuffle(alphabet, salt []byte) []byte {
+	result := make([]byte, len(alphabet))
+	copy(result, alphabet)
+	if len(salt) == 0 {
+		return result
+	}
+
+	for i, v, p := len(result)-1, 0, 0; i > 0; i-- {
+		p += int(salt[v])
+		j := (int(salt[v]) + v + p) % i
+		result[i], result[j] = result[j], result[i]
+		v = (v + 1) % len(salt)
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package codegen
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+)
+
+const (
+	defaultRandomLength = 8
+	maxRandomAttempts   = 10
+)
+
+// Random выдаёт случайные коды фиксированной длины.
+type Random struct {
+	db     store.Database
+	length int
+}
+
+// NewRandom возвращает генератор случайных кодов.
+func NewRandom(db store.Database, length int) (*Random, error) {
+	if length == 0 {
+		length = defaultRandomLength
+	}
+	if length < 0 {
+		return nil, errors.New("error from codegen. code length must be positive")
+	}
+
+	return &Random{
+		db:     db,
+		length: length,
+	}, nil
+}
+
+// Generate возвращает случайный свободный код, повторяя попытку при коллизии.
+func (r *Random) Generate(ctx context.Context) (string, error) {
+	for i := 0; i < maxRandomAttempts; i++ {
+		code, err := r.random()
+		if err != nil {
+			return "", err
+		}
+
+		ok, err := exists(ctx, r.db, code)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return code, nil
+		}
+	}
+
+	return "", ErrExhausted
+}
+
+func (r *Random) random() (string, error) {
+	max := big.NewInt(int64(len(base62Alphabet)))
+	code := make([]byte, r.length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("error from codegen. can't read random - %w", err)
+		}
+		code[i] = base62Alphabet[n.Int64()]
+	}
+	return string(code), nil
+}
@@ -0,0 +1,75 @@
+package codegen
+
+import (
+	"context"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+)
+
+// Sequence выдаёт коды на основе возрастающего счётчика.
+// Счётчик хранится в хранилище, поэтому продолжается после перезапуска
+// и общий для всех экземпляров сервиса. Занятые коды (например, пользовательские
+// псевдонимы) пропускаются, поэтому старые ссылки никогда не перезаписываются.
+type Sequence struct {
+	db     store.Database
+	encode func(n uint64) string
+}
+
+// NewBase62 возвращает счётчик, кодируемый в base62.
+func NewBase62(db store.Database) *Sequence {
+	return &Sequence{
+		db:     db,
+		encode: encodeBase62,
+	}
+}
+
+// NewHashids возвращает счётчик, обфусцированный по мотивам Hashids:
+// алфавит перемешивается солью, а коды дополняются до minLength.
+func NewHashids(db store.Database, salt string, minLength int) *Sequence {
+	h := newHashids(salt, minLength)
+	return &Sequence{
+		db:     db,
+		encode: h.encode,
+	}
+}
+
+// Generate возвращает следующий свободный код.
+func (s *Sequence) Generate(ctx context.Context) (string, error) {
+	for {
+		n, err := s.db.NextCodeNumber(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		code := s.encode(n)
+		ok, err := exists(ctx, s.db, code)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return code, nil
+		}
+	}
+}
+
+// encodeBase62 переводит число в base62.
+func encodeBase62(n uint64) string {
+	return encode(n, []byte(base62Alphabet))
+}
+
+// encode переводит число в систему счисления с заданным алфавитом.
+func encode(n uint64, alphabet []byte) string {
+	if n == 0 {
+		return string(alphabet[0])
+	}
+
+	base := uint64(len(alphabet))
+	var buf [64]byte
+	i := len(buf)
+	for n > 0 {
+		i--
+		buf[i] = alphabet[n%base]
+		n /= base
+	}
+	return string(buf[i:])
+}
@@ -0,0 +1,74 @@
+package filestorage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+// clickBucket хранит вложенный bucket с переходами для каждого кода.
+const clickBucket = "ClickBucket"
+
+// WriteClicks сохраняет переходы в файл.
+func (d *BoltDB) WriteClicks(ctx context.Context, clicks []store.Click) error {
+	return d.update(ctx, func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(clickBucket))
+		for _, click := range clicks {
+			b, err := root.CreateBucketIfNotExists([]byte(click.Code))
+			if err != nil {
+				return fmt.Errorf("error from file. create bucket: %s", err)
+			}
+
+			data, err := json.Marshal(click)
+			if err != nil {
+				return fmt.Errorf("error from file. can't convert click for bucket - %s ", err)
+			}
+
+			seq, err := b.NextSequence()
+			if err != nil {
+				return fmt.Errorf("error from file. can't add click to bucket - %s ", err)
+			}
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, seq)
+
+			if err := b.Put(key, data); err != nil {
+				return fmt.Errorf("error from file. can't add click to bucket - %s ", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ClickStats возвращает статистику переходов по коду.
+func (d *BoltDB) ClickStats(ctx context.Context, code string) (store.ClickStats, error) {
+	var clicks []store.Click
+
+	err := d.view(ctx, func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(clickBucket)).Bucket([]byte(code))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, value []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var click store.Click
+			if err := json.Unmarshal(value, &click); err != nil {
+				return fmt.Errorf("error from file. can't convert click from bucket - %s ", err)
+			}
+			clicks = append(clicks, click)
+			return nil
+		})
+	})
+	if err != nil {
+		return store.ClickStats{}, err
+	}
+
+	return store.AggregateClicks(clicks), nil
+}
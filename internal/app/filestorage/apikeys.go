@@ -0,0 +1,116 @@
+package filestorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// хеш → API ключ
+	apiKeyBucket = "APIKeyBucket"
+	// идентификатор → хеш API ключа
+	apiKeyIDBucket = "APIKeyIDBucket"
+)
+
+// CreateAPIKey сохраняет ключ в файл.
+func (d *BoltDB) CreateAPIKey(ctx context.Context, key *store.APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("error from file. can't convert api key for bucket - %s ", err)
+	}
+
+	return d.update(ctx, func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte(apiKeyBucket)).Put([]byte(key.Hash), data); err != nil {
+			return fmt.Errorf("error from file. can't add api key to bucket - %s ", err)
+		}
+		if err := tx.Bucket([]byte(apiKeyIDBucket)).Put([]byte(key.ID), []byte(key.Hash)); err != nil {
+			return fmt.Errorf("error from file. can't add api key to bucket - %s ", err)
+		}
+		return nil
+	})
+}
+
+// APIKeyByHash возвращает ключ по хешу.
+func (d *BoltDB) APIKeyByHash(ctx context.Context, hash string) (store.APIKey, error) {
+	var key store.APIKey
+	err := d.view(ctx, func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(apiKeyBucket)).Get([]byte(hash))
+		if v == nil {
+			return store.ErrNotFound
+		}
+		return decodeAPIKey(v, &key)
+	})
+	return key, err
+}
+
+// ListAPIKeys возвращает ключи пользователя в порядке создания.
+func (d *BoltDB) ListAPIKeys(ctx context.Context, userID int) ([]store.APIKey, error) {
+	var keys []store.APIKey
+	err := d.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(apiKeyBucket)).ForEach(func(_, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var key store.APIKey
+			if err := decodeAPIKey(v, &key); err != nil {
+				return err
+			}
+			if key.UserID == userID {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+// RevokeAPIKey удаляет ключ пользователя.
+func (d *BoltDB) RevokeAPIKey(ctx context.Context, userID int, id string) error {
+	return d.update(ctx, func(tx *bolt.Tx) error {
+		ids := tx.Bucket([]byte(apiKeyIDBucket))
+		hash := ids.Get([]byte(id))
+		if hash == nil {
+			return store.ErrNotFound
+		}
+
+		keys := tx.Bucket([]byte(apiKeyBucket))
+		var key store.APIKey
+		if err := decodeAPIKey(keys.Get(hash), &key); err != nil {
+			return err
+		}
+		if key.UserID != userID {
+			return store.ErrNotFound
+		}
+
+		if err := keys.Delete(hash); err != nil {
+			return fmt.Errorf("error from file. can't revoke api key - %s ", err)
+		}
+		if err := ids.Delete([]byte(id)); err != nil {
+			return fmt.Errorf("error from file. can't revoke api key - %s ", err)
+		}
+		return nil
+	})
+}
+
+func decodeAPIKey(data []byte, key *store.APIKey) error {
+	if err := json.Unmarshal(data, key); err != nil {
+		return fmt.Errorf("error from file. can't convert api key from bucket - %s ", err)
+	}
+	return nil
+}
@@ -1,168 +1,437 @@
 package filestorage
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/AlexCorn999/short-url-service/internal/app/store"
 	bolt "go.etcd.io/bbolt"
 )
 
+// Bucket'ы базы данных.
+const (
+	// код → url
+	urlBucket = "URLBucket"
+	// создатель → вложенный bucket с его кодами
+	creatorBucket = "CreatorBucket"
+	// исходный url → код
+	originalBucket = "OriginalBucket"
+	// последовательность содержит последний выданный идентификатор пользователя
+	userBucket = "UserBucket"
+	// последовательность содержит последний выданный номер кода
+	codeBucket = "CodeBucket"
+)
+
 // BoltDB реализует хранение в файле.
 type BoltDB struct {
-	Store  *bolt.DB
-	Bucket *bolt.Bucket
+	Store *bolt.DB
 }
 
 // NewBoltDB инициализирует базу данных.
+// Для файлов, созданных до появления индексов или счётчиков,
+// они заполняются при открытии.
 func NewBoltDB(filePath string) (*BoltDB, error) {
 	db, err := bolt.Open(filePath, 0666, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error from file. can't open file - %s ", err)
 	}
 
-	var b *bolt.Bucket
 	err = db.Update(func(tx *bolt.Tx) error {
-		b, err = tx.CreateBucket([]byte("URLBucket"))
-		if err != nil {
-			return fmt.Errorf("error from file. create bucket: %s", err)
+		reindex := tx.Bucket([]byte(creatorBucket)) == nil || tx.Bucket([]byte(originalBucket)) == nil
+		reseed := tx.Bucket([]byte(userBucket)) == nil
+		reseedCodes := tx.Bucket([]byte(codeBucket)) == nil
+
+		for _, name := range []string{urlBucket, creatorBucket, originalBucket, clickBucket, userBucket, codeBucket, accountBucket, accountIDBucket, apiKeyBucket, apiKeyIDBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return fmt.Errorf("error from file. create bucket: %s", err)
+			}
+		}
+
+		if reindex {
+			if err := buildIndexes(tx); err != nil {
+				return err
+			}
+		}
+		if reseed {
+			if err := seedUserID(tx); err != nil {
+				return err
+			}
+		}
+		if reseedCodes {
+			return seedCodeNumber(tx)
 		}
 		return nil
 	})
 	if err != nil {
+		db.Close()
 		return nil, fmt.Errorf("error from file. can't create bucket for url - %s ", err)
 	}
 
 	return &BoltDB{
-		Store:  db,
-		Bucket: b,
+		Store: db,
 	}, nil
 }
 
-// WriteURL записывает url по ключу
-func (d *BoltDB) WriteURL(url *store.URL, id int, ssh *string) error {
+// buildIndexes заполняет индексы по уже сохранённым url.
+func buildIndexes(tx *bolt.Tx) error {
+	return tx.Bucket([]byte(urlBucket)).ForEach(func(k, value []byte) error {
+		url, err := decodeURL(k, value)
+		if err != nil {
+			return err
+		}
+		return index(tx, &url)
+	})
+}
+
+// index добавляет код в индексы по создателю и исходному url.
+func index(tx *bolt.Tx, url *store.URL) error {
+	code := url.Code
+	creators := tx.Bucket([]byte(creatorBucket))
+	b, err := creators.CreateBucketIfNotExists(creatorKey(url.Creator))
+	if err != nil {
+		return fmt.Errorf("error from file. create bucket: %s", err)
+	}
+	if err := b.Put([]byte(code), nil); err != nil {
+		return fmt.Errorf("error from file. can't index url - %s ", err)
+	}
+
+	// удалённые url не занимают исходный url
+	if url.DeletedFlag {
+		return nil
+	}
+
+	// для старых файлов с повторами в индексе остаётся первый код
+	originals := tx.Bucket([]byte(originalBucket))
+	if originals.Get([]byte(url.OriginalURL)) != nil {
+		return nil
+	}
+	if err := originals.Put([]byte(url.OriginalURL), []byte(code)); err != nil {
+		return fmt.Errorf("error from file. can't index url - %s ", err)
+	}
+	return nil
+}
+
+// unindexOriginal освобождает исходный url, если он указывает на код url.
+func unindexOriginal(tx *bolt.Tx, url *store.URL) error {
+	originals := tx.Bucket([]byte(originalBucket))
+	if string(originals.Get([]byte(url.OriginalURL))) != url.Code {
+		return nil
+	}
+	if err := originals.Delete([]byte(url.OriginalURL)); err != nil {
+		return fmt.Errorf("error from file. can't unindex url - %s ", err)
+	}
+	return nil
+}
+
+// view выполняет транзакцию чтения, если ctx ещё не отменён.
+func (d *BoltDB) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return d.Store.View(fn)
+}
+
+// update выполняет транзакцию записи. Если ctx отменён до фиксации,
+// транзакция откатывается.
+func (d *BoltDB) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return d.Store.Update(func(tx *bolt.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return ctx.Err()
+	})
+}
+
+func creatorKey(creator int) []byte {
+	return []byte(strconv.Itoa(creator))
+}
+
+func encodeURL(url *store.URL) ([]byte, error) {
 	data, err := json.Marshal(url)
 	if err != nil {
-		return fmt.Errorf("error from file. can't convert url for bucket - %s ", err)
+		return nil, fmt.Errorf("error from file. can't convert url for bucket - %s ", err)
 	}
+	return data, nil
+}
+
+// decodeURL читает url, сохранённый под ключом code.
+// В старых записях кода нет, поэтому он берётся из ключа.
+func decodeURL(code, data []byte) (store.URL, error) {
+	var url store.URL
+	if err := json.Unmarshal(data, &url); err != nil {
+		return url, fmt.Errorf("error from file. can't convert url from bucket - %s ", err)
+	}
+	url.Code = string(code)
+	return url, nil
+}
 
-	d.Store.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("URLBucket"))
-		err := b.Put([]byte(*ssh), data)
+// WriteURL записывает url по ключу url.Code.
+// Если исходный url уже сокращён, в url.Code записывается существующий код
+// и возвращается store.ErrConfilict. Url с истёкшим сроком помечается удалённым
+// и не мешает сократить исходный url заново.
+func (d *BoltDB) WriteURL(ctx context.Context, url *store.URL) error {
+	data, err := encodeURL(url)
+	if err != nil {
 		return err
+	}
+
+	return d.update(ctx, func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(urlBucket))
+
+		if code := tx.Bucket([]byte(originalBucket)).Get([]byte(url.OriginalURL)); code != nil {
+			existing, err := decodeURL(code, b.Get(code))
+			if err != nil {
+				return err
+			}
+			if !existing.Expired(time.Now()) {
+				url.Code = existing.Code
+				return store.ErrConfilict
+			}
+			if err := markDeleted(tx, &existing); err != nil {
+				return err
+			}
+		}
+
+		if b.Get([]byte(url.Code)) != nil {
+			return &store.DuplicateCodeError{Code: url.Code}
+		}
+		if err := b.Put([]byte(url.Code), data); err != nil {
+			return fmt.Errorf("error from file. can't add url to bucket - %s ", err)
+		}
+		return index(tx, url)
 	})
-	return nil
 }
 
 // ReadURL вычитывает url по ключу.
-func (d *BoltDB) ReadURL(url *store.URL, ssh string) error {
-	var v []byte
-	d.Store.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("URLBucket"))
-		v = b.Get([]byte(ssh))
+func (d *BoltDB) ReadURL(ctx context.Context, url *store.URL, ssh string) error {
+	err := d.view(ctx, func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(urlBucket)).Get([]byte(ssh))
+		if v == nil {
+			return store.ErrNotFound
+		}
+
+		value, err := decodeURL([]byte(ssh), v)
+		if err != nil {
+			return err
+		}
+		*url = value
 		return nil
 	})
-
-	if err := json.Unmarshal(v, url); err != nil {
-		return fmt.Errorf("error from file. can't convert url from bucket - %s ", err)
+	if err != nil {
+		return err
 	}
 
 	if url.DeletedFlag {
 		return store.ErrDeleted
 	}
 
+	if url.Expired(time.Now()) {
+		return store.ErrExpired
+	}
+
 	return nil
 }
 
 // GetAllURL возвращает все сокращенные url пользователя.
-func (d *BoltDB) GetAllURL(id int) ([]store.URL, error) {
+func (d *BoltDB) GetAllURL(ctx context.Context, id int) ([]store.URL, error) {
 	var userURL []store.URL
 
-	d.Store.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("URLBucket"))
-		c := b.Cursor()
-		for k, value := c.First(); k != nil; k, value = c.Next() {
-			var url store.URL
-			if err := json.Unmarshal([]byte(value), &url); err != nil {
-				return fmt.Errorf("error from file. can't convert url from bucket - %s ", err)
-			}
-			if url.Creator == id {
-				userURL = append(userURL, url)
+	err := d.view(ctx, func(tx *bolt.Tx) error {
+		codes := tx.Bucket([]byte(creatorBucket)).Bucket(creatorKey(id))
+		if codes == nil {
+			return nil
+		}
+
+		urls := tx.Bucket([]byte(urlBucket))
+		return codes.ForEach(func(code, _ []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
 			}
 
-		}
-		return nil
+			url, err := decodeURL(code, urls.Get(code))
+			if err != nil {
+				return err
+			}
+			userURL = append(userURL, url)
+			return nil
+		})
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return userURL, nil
 }
 
 // DeleteURL удаляет url у текущего пользователя.
-func (d *BoltDB) DeleteURL(tasks []store.Task) error {
+func (d *BoltDB) DeleteURL(ctx context.Context, tasks []store.Task) error {
+	return d.update(ctx, func(tx *bolt.Tx) error {
+		urls := tx.Bucket([]byte(urlBucket))
+		creators := tx.Bucket([]byte(creatorBucket))
 
-	type valuesForDelete struct {
-		key  string
-		data []byte
-	}
+		for _, task := range tasks {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
-	var forDelete []valuesForDelete
+			codes := creators.Bucket(creatorKey(task.Creator))
+			if codes == nil || codes.Get([]byte(task.Code)) == nil {
+				continue
+			}
 
-	for _, task := range tasks {
-		d.Store.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("URLBucket"))
-			c := b.Cursor()
-			for k, value := c.First(); k != nil; k, value = c.Next() {
-				var url store.URL
-				if err := json.Unmarshal([]byte(value), &url); err != nil {
-					return fmt.Errorf("error from file. can't convert url from bucket - %s ", err)
-				}
+			url, err := decodeURL([]byte(task.Code), urls.Get([]byte(task.Code)))
+			if err != nil {
+				return err
+			}
 
-				if url.ShortURL == task.Link && url.Creator == task.Creator {
-					url.DeletedFlag = true
-					data, err := json.Marshal(url)
-					if err != nil {
-						return fmt.Errorf("error from file. can't convert url for bucket - %s ", err)
-					}
+			if err := markDeleted(tx, &url); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-					var val valuesForDelete
-					val.key = string(k)
-					val.data = data
-					forDelete = append(forDelete, val)
-				}
+// markDeleted помечает url удалённым и освобождает его исходный url.
+func markDeleted(tx *bolt.Tx, url *store.URL) error {
+	url.DeletedFlag = true
+	data, err := encodeURL(url)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket([]byte(urlBucket)).Put([]byte(url.Code), data); err != nil {
+		return fmt.Errorf("error from file. can't delete url from bucket - %s ", err)
+	}
+	return unindexOriginal(tx, url)
+}
+
+// DeleteExpiredURL помечает удалёнными url с истёкшим сроком жизни.
+func (d *BoltDB) DeleteExpiredURL(ctx context.Context, now time.Time) (int, error) {
+	deleted := 0
+	err := d.update(ctx, func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(urlBucket))
+
+		var forDelete []store.URL
+		err := b.ForEach(func(k, value []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			url, err := decodeURL(k, value)
+			if err != nil {
+				return err
+			}
 
+			if url.DeletedFlag || !url.Expired(now) {
+				return nil
 			}
+
+			forDelete = append(forDelete, url)
 			return nil
 		})
-	}
+		if err != nil {
+			return err
+		}
 
-	// перезапись значения
-	d.Store.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("URLBucket"))
-		for _, value := range forDelete {
-			b.Put([]byte(value.key), value.data)
+		// перезапись значений вне обхода курсором
+		for i := range forDelete {
+			if err := markDeleted(tx, &forDelete[i]); err != nil {
+				return err
+			}
 		}
+		deleted = len(forDelete)
 		return nil
 	})
 
-	return nil
+	return deleted, err
 }
 
 func (d *BoltDB) Close() error {
 	return d.Store.Close()
 }
 
-func (d *BoltDB) CheckPing() error {
-	return nil
+// CheckPing проверяет, что файл базы данных открыт.
+func (d *BoltDB) CheckPing(ctx context.Context) error {
+	return d.view(ctx, func(tx *bolt.Tx) error {
+		return nil
+	})
 }
 
-func (d *BoltDB) Conflict(url *store.URL) (string, error) {
-	return "", nil
+// Conflict возвращает код, под которым уже сокращён исходный url.
+func (d *BoltDB) Conflict(ctx context.Context, url *store.URL) (string, error) {
+	var code string
+	err := d.view(ctx, func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(originalBucket)).Get([]byte(url.OriginalURL))
+		if v == nil {
+			return store.ErrNotFound
+		}
+		code = string(v)
+		return nil
+	})
+	return code, err
 }
 
-func (d *BoltDB) RewriteURL(url *store.URL) error {
-	return nil
+// NextUserID выдаёт следующий идентификатор пользователя.
+// Счётчик хранится в последовательности userBucket и переживает перезапуск.
+func (d *BoltDB) NextUserID(ctx context.Context) (int, error) {
+	var id uint64
+	err := d.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		id, err = tx.Bucket([]byte(userBucket)).NextSequence()
+		if err != nil {
+			return fmt.Errorf("error from file. can't allocate user id - %s ", err)
+		}
+		return nil
+	})
+	return int(id), err
+}
+
+// seedUserID продолжает счётчик пользователей после уже выданных идентификаторов
+// для файлов, созданных до его появления.
+func seedUserID(tx *bolt.Tx) error {
+	maxID := 0
+	err := tx.Bucket([]byte(creatorBucket)).ForEach(func(k, _ []byte) error {
+		creator, err := strconv.Atoi(string(k))
+		if err != nil {
+			return fmt.Errorf("error from file. can't read user id - %s ", err)
+		}
+		if creator > maxID {
+			maxID = creator
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket([]byte(userBucket)).SetSequence(uint64(maxID))
+}
+
+// NextCodeNumber выдаёт следующий номер кода.
+// Счётчик хранится в последовательности codeBucket и переживает перезапуск.
+func (d *BoltDB) NextCodeNumber(ctx context.Context) (uint64, error) {
+	var n uint64
+	err := d.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.Bucket([]byte(codeBucket)).NextSequence()
+		if err != nil {
+			return fmt.Errorf("error from file. can't allocate code number - %s ", err)
+		}
+		return nil
+	})
+	return n, err
 }
 
-func (d *BoltDB) InitID() (int, error) {
-	return -1, nil
+// seedCodeNumber продолжает счётчик кодов после уже сохранённых url
+// для файлов, созданных до его появления. Коды, занятые до этого номера,
+// генератор пропускает сам.
+func seedCodeNumber(tx *bolt.Tx) error {
+	count := tx.Bucket([]byte(urlBucket)).Stats().KeyN
+	return tx.Bucket([]byte(codeBucket)).SetSequence(uint64(count))
 }
@@ -0,0 +1,159 @@
+package filestorage
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	"github.com/AlexCorn999/short-url-service/internal/app/store/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestDB(t *testing.T) (*BoltDB, string) {
+	path := filepath.Join(t.TempDir(), "short-url-db.json")
+	db, err := NewBoltDB(path)
+	require.NoError(t, err)
+	return db, path
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+
+	db, _ := newTestDB(t)
+	defer db.Close()
+
+	const writers = 4
+	const perWriter = 50
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(creator int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				code := fmt.Sprintf("%d-%d", creator, i)
+				url := store.NewURL(code, "http://origin.ru/"+code, creator)
+				assert.NoError(t, db.WriteURL(ctx, url))
+
+				var read store.URL
+				assert.NoError(t, db.ReadURL(ctx, &read, code))
+
+				_, err := db.GetAllURL(ctx, creator)
+				assert.NoError(t, err)
+
+				if i%2 == 0 {
+					assert.NoError(t, db.DeleteURL(ctx, []store.Task{*store.NewTask(code, creator)}))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for w := 0; w < writers; w++ {
+		urls, err := db.GetAllURL(ctx, w)
+		require.NoError(t, err)
+		require.Len(t, urls, perWriter)
+
+		deleted := 0
+		for _, url := range urls {
+			if url.DeletedFlag {
+				deleted++
+			}
+		}
+		assert.Equal(t, perWriter/2, deleted)
+	}
+}
+
+func TestReopenBuildsIndexes(t *testing.T) {
+	ctx := context.Background()
+
+	db, path := newTestDB(t)
+
+	// файл без индексов, как до их появления
+	require.NoError(t, db.WriteURL(ctx, store.NewURL("1", "http://one.ru", 7)))
+	require.NoError(t, db.Store.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(creatorBucket)); err != nil {
+			return err
+		}
+		return tx.DeleteBucket([]byte(originalBucket))
+	}))
+	require.NoError(t, db.Close())
+
+	db, err := NewBoltDB(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	urls, err := db.GetAllURL(ctx, 7)
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "http://one.ru", urls[0].OriginalURL)
+	assert.Equal(t, "1", urls[0].Code)
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Database {
+		db, _ := newTestDB(t)
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+func TestNextUserIDSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+
+	db, path := newTestDB(t)
+
+	// файл без счётчика, как до его появления
+	require.NoError(t, db.WriteURL(ctx, store.NewURL("1", "http://one.ru", 7)))
+	require.NoError(t, db.Store.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(userBucket))
+	}))
+	require.NoError(t, db.Close())
+
+	db, err := NewBoltDB(path)
+	require.NoError(t, err)
+	id, err := db.NextUserID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 8, id)
+	require.NoError(t, db.Close())
+
+	db, err = NewBoltDB(path)
+	require.NoError(t, err)
+	defer db.Close()
+	id, err = db.NextUserID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 9, id)
+}
+
+func TestNextCodeNumberSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+
+	db, path := newTestDB(t)
+
+	// файл без счётчика, как до его появления
+	require.NoError(t, db.WriteURL(ctx, store.NewURL("a", "http://one.ru", 7)))
+	require.NoError(t, db.WriteURL(ctx, store.NewURL("b", "http://two.ru", 7)))
+	require.NoError(t, db.Store.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(codeBucket))
+	}))
+	require.NoError(t, db.Close())
+
+	db, err := NewBoltDB(path)
+	require.NoError(t, err)
+	n, err := db.NextCodeNumber(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), n)
+	require.NoError(t, db.Close())
+
+	db, err = NewBoltDB(path)
+	require.NoError(t, err)
+	defer db.Close()
+	n, err = db.NextCodeNumber(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), n)
+}
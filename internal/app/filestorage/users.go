@@ -0,0 +1,113 @@
+package filestorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// логин → зарегистрированный пользователь
+	accountBucket = "AccountBucket"
+	// идентификатор → логин зарегистрированного пользователя
+	accountIDBucket = "AccountIDBucket"
+)
+
+// CreateUser сохраняет пользователя в файл.
+func (d *BoltDB) CreateUser(ctx context.Context, user *store.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("error from file. can't convert user for bucket - %s ", err)
+	}
+
+	return d.update(ctx, func(tx *bolt.Tx) error {
+		accounts := tx.Bucket([]byte(accountBucket))
+		if accounts.Get([]byte(user.Login)) != nil {
+			return store.ErrUserExists
+		}
+
+		if err := accounts.Put([]byte(user.Login), data); err != nil {
+			return fmt.Errorf("error from file. can't add user to bucket - %s ", err)
+		}
+		if err := tx.Bucket([]byte(accountIDBucket)).Put(creatorKey(user.ID), []byte(user.Login)); err != nil {
+			return fmt.Errorf("error from file. can't add user to bucket - %s ", err)
+		}
+		return nil
+	})
+}
+
+// UserByLogin возвращает пользователя по логину.
+func (d *BoltDB) UserByLogin(ctx context.Context, login string) (store.User, error) {
+	var user store.User
+	err := d.view(ctx, func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(accountBucket)).Get([]byte(login))
+		if v == nil {
+			return store.ErrNotFound
+		}
+
+		if err := json.Unmarshal(v, &user); err != nil {
+			return fmt.Errorf("error from file. can't convert user from bucket - %s ", err)
+		}
+		return nil
+	})
+	return user, err
+}
+
+// ClaimURLs передаёт ссылки анонимного пользователя from пользователю to.
+func (d *BoltDB) ClaimURLs(ctx context.Context, from, to int) (int, error) {
+	claimed := 0
+	err := d.update(ctx, func(tx *bolt.Tx) error {
+		if from == to || tx.Bucket([]byte(accountIDBucket)).Get(creatorKey(from)) != nil {
+			return nil
+		}
+
+		creators := tx.Bucket([]byte(creatorBucket))
+		codes := creators.Bucket(creatorKey(from))
+		if codes == nil {
+			return nil
+		}
+
+		target, err := creators.CreateBucketIfNotExists(creatorKey(to))
+		if err != nil {
+			return fmt.Errorf("error from file. create bucket: %s", err)
+		}
+
+		urls := tx.Bucket([]byte(urlBucket))
+		err = codes.ForEach(func(code, _ []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			url, err := decodeURL(code, urls.Get(code))
+			if err != nil {
+				return err
+			}
+
+			url.Creator = to
+			data, err := encodeURL(&url)
+			if err != nil {
+				return err
+			}
+			if err := urls.Put(code, data); err != nil {
+				return fmt.Errorf("error from file. can't claim url - %s ", err)
+			}
+			if err := target.Put(code, nil); err != nil {
+				return fmt.Errorf("error from file. can't claim url - %s ", err)
+			}
+			claimed++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return creators.DeleteBucket(creatorKey(from))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return claimed, nil
+}
@@ -1,12 +1,23 @@
 package logger
 
 import (
+	"fmt"
+	"math/rand"
 	"net/http"
 	"time"
 
+	"github.com/AlexCorn999/short-url-service/internal/app/auth"
+	"github.com/AlexCorn999/short-url-service/internal/app/requestid"
+	"github.com/go-chi/chi"
 	log "github.com/sirupsen/logrus"
 )
 
+// Форматы логов.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
 type (
 	// Структура для хранения сведений об ответе для middleware
 	ResponseData struct {
@@ -14,7 +25,8 @@ type (
 		Size   int
 	}
 
-	// Реализация http.ResponseWriter
+	// Реализация http.ResponseWriter, запоминает код и размер ответа.
+	// Используется также в middleware метрик и трассировки.
 	LoggingResponseWriter struct {
 		http.ResponseWriter
 		ResponseData *ResponseData
@@ -22,6 +34,9 @@ type (
 )
 
 func (r *LoggingResponseWriter) Write(b []byte) (int, error) {
+	if r.ResponseData.Status == 0 {
+		r.ResponseData.Status = http.StatusOK
+	}
 	size, err := r.ResponseWriter.Write(b)
 	r.ResponseData.Size += size
 	return size, err
@@ -29,13 +44,44 @@ func (r *LoggingResponseWriter) Write(b []byte) (int, error) {
 
 func (r *LoggingResponseWriter) WriteHeader(statusCode int) {
 	r.ResponseWriter.WriteHeader(statusCode)
-	r.ResponseData.Status = statusCode
+	if r.ResponseData.Status == 0 {
+		r.ResponseData.Status = statusCode
+	}
+}
+
+// NewFormatter возвращает форматтер logrus для формата text или json.
+func NewFormatter(format string) (log.Formatter, error) {
+	switch format {
+	case FormatText, "":
+		return &log.TextFormatter{}, nil
+	case FormatJSON:
+		return &log.JSONFormatter{}, nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// Logger журнал запросов.
+type Logger struct {
+	logger *log.Logger
+	// доля записываемых перенаправлений
+	redirectSample float64
+}
+
+// New создаёт журнал запросов, который пишет в logger.
+// Из успешных перенаправлений записывается только доля redirectSample от 0 до 1,
+// остальные ответы записываются всегда.
+func New(logger *log.Logger, redirectSample float64) *Logger {
+	return &Logger{
+		logger:         logger,
+		redirectSample: redirectSample,
+	}
 }
 
 // WithLogging выполняет функцию middleware с логированием.
-// Содержит сведения о URI, методе запроса и времени, затраченного на его выполнение.
+// Содержит сведения о URI, методе запроса и времени, затраченного на его выполнение,
+// идентификатор запроса, пользователя и шаблон маршрута chi.
 // Сведения об ответах должны содержать код статуса и размер содержимого ответа.
-func WithLogging(next http.Handler) http.Handler {
+func (l *Logger) WithLogging(next http.Handler) http.Handler {
 	logFn := func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
@@ -52,13 +98,37 @@ func WithLogging(next http.Handler) http.Handler {
 
 		duration := time.Since(start)
 
-		log.WithFields(log.Fields{
-			"uri":      r.RequestURI,
-			"method":   r.Method,
-			"duration": duration,
-			"status":   responseData.Status,
-			"size":     responseData.Size,
-		}).Info("request details: ")
+		if responseData.Status == 0 {
+			responseData.Status = http.StatusOK
+		}
+		if !l.sampled(responseData.Status) {
+			return
+		}
+
+		fields := log.Fields{
+			"uri":        r.RequestURI,
+			"method":     r.Method,
+			"duration":   duration,
+			"status":     responseData.Status,
+			"size":       responseData.Size,
+			"request_id": requestid.FromContext(r.Context()),
+		}
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			fields["route"] = rctx.RoutePattern()
+		}
+		if userID, ok := auth.UserIDFromContext(r.Context()); ok {
+			fields["user_id"] = userID
+		}
+
+		l.logger.WithContext(r.Context()).WithFields(fields).Info("request details: ")
 	}
 	return http.HandlerFunc(logFn)
 }
+
+// sampled сообщает, нужно ли записать ответ со статусом status.
+func (l *Logger) sampled(status int) bool {
+	if status < http.StatusMultipleChoices || status >= http.StatusBadRequest || status == http.StatusNotModified {
+		return true
+	}
+	return l.redirectSample >= 1 || rand.Float64() < l.redirectSample
+}
@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/auth"
+	"github.com/AlexCorn999/short-url-service/internal/app/requestid"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRouter возвращает роутер с журналом запросов в out.
+func newTestRouter(out *bytes.Buffer, redirectSample float64) *chi.Mux {
+	logger := log.New()
+	logger.SetOutput(out)
+	logger.SetFormatter(&log.JSONFormatter{})
+
+	router := chi.NewRouter()
+	router.Use(requestid.Middleware)
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(auth.WithUserID(r.Context(), 7)))
+		})
+	})
+	router.Use(New(logger, redirectSample).WithLogging)
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "id") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+	router.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	return router
+}
+
+// entries разбирает записи журнала в формате JSON.
+func entries(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var result []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(line, &entry))
+		result = append(result, entry)
+	}
+	return result
+}
+
+func TestWithLogging(t *testing.T) {
+	var out bytes.Buffer
+	router := newTestRouter(&out, 1)
+
+	r := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	r.Header.Set(requestid.Header, "req-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, "req-1", w.Header().Get(requestid.Header))
+
+	logged := entries(t, &out)
+	require.Len(t, logged, 1)
+	entry := logged[0]
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.Equal(t, 7.0, entry["user_id"])
+	assert.Equal(t, "/ping", entry["route"])
+	assert.Equal(t, "/ping", entry["uri"])
+	assert.Equal(t, 200.0, entry["status"])
+	assert.Equal(t, 2.0, entry["size"])
+}
+
+func TestWithLoggingRedirectSample(t *testing.T) {
+	var out bytes.Buffer
+	router := newTestRouter(&out, 0)
+
+	for _, target := range []string{"/abc", "/def", "/missing", "/ping"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	// перенаправления пропущены, ошибки и остальные ответы записаны
+	logged := entries(t, &out)
+	require.Len(t, logged, 2)
+	assert.Equal(t, "/{id}", logged[0]["route"])
+	assert.Equal(t, 404.0, logged[0]["status"])
+	assert.Equal(t, "/ping", logged[1]["route"])
+	// идентификатор создаётся, если клиент его не передал
+	assert.Len(t, logged[1]["request_id"], 32)
+
+	out.Reset()
+	router = newTestRouter(&out, 1)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abc", nil))
+	assert.Len(t, entries(t, &out), 1)
+}
+
+func TestNewFormatter(t *testing.T) {
+	formatter, err := NewFormatter(FormatJSON)
+	require.NoError(t, err)
+	assert.IsType(t, &log.JSONFormatter{}, formatter)
+
+	formatter, err = NewFormatter(FormatText)
+	require.NoError(t, err)
+	assert.IsType(t, &log.TextFormatter{}, formatter)
+
+	_, err = NewFormatter("xml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,34 @@
+package memorystorage
+
+import (
+	"context"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+)
+
+// WriteClicks сохраняет переходы в памяти.
+func (m *MemoryStorage) WriteClicks(ctx context.Context, clicks []store.Click) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.clicksMu.Lock()
+	defer m.clicksMu.Unlock()
+
+	for _, click := range clicks {
+		m.clicks[click.Code] = append(m.clicks[click.Code], click)
+	}
+	return nil
+}
+
+// ClickStats возвращает статистику переходов по коду.
+func (m *MemoryStorage) ClickStats(ctx context.Context, code string) (store.ClickStats, error) {
+	if err := ctx.Err(); err != nil {
+		return store.ClickStats{}, err
+	}
+
+	m.clicksMu.RLock()
+	defer m.clicksMu.RUnlock()
+
+	return store.AggregateClicks(m.clicks[code]), nil
+}
@@ -0,0 +1,85 @@
+package memorystorage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+)
+
+// CreateAPIKey сохраняет ключ в памяти.
+func (m *MemoryStorage) CreateAPIKey(ctx context.Context, key *store.APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *key
+	stored.Scopes = append([]string(nil), key.Scopes...)
+	m.apiKeys[key.Hash] = stored
+	return nil
+}
+
+// APIKeyByHash возвращает ключ по хешу.
+func (m *MemoryStorage) APIKeyByHash(ctx context.Context, hash string) (store.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return store.APIKey{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, ok := m.apiKeys[hash]
+	if !ok {
+		return store.APIKey{}, store.ErrNotFound
+	}
+	return key, nil
+}
+
+// ListAPIKeys возвращает ключи пользователя в порядке создания.
+func (m *MemoryStorage) ListAPIKeys(ctx context.Context, userID int) ([]store.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keys []store.APIKey
+	for _, key := range m.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sortAPIKeys(keys)
+	return keys, nil
+}
+
+// RevokeAPIKey удаляет ключ пользователя.
+func (m *MemoryStorage) RevokeAPIKey(ctx context.Context, userID int, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, key := range m.apiKeys {
+		if key.ID == id && key.UserID == userID {
+			delete(m.apiKeys, hash)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func sortAPIKeys(keys []store.APIKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+}
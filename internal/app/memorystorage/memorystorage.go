@@ -1,116 +1,242 @@
 package memorystorage
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/AlexCorn999/short-url-service/internal/app/store"
 )
 
 // MemoryStorage реализует хранение в мапе.
+// Все операции защищены мьютексом, поэтому хранилище можно использовать
+// одновременно из обработчиков и фоновых воркеров.
+// Операции выполняются без ожидания ввода-вывода, поэтому контекст
+// проверяется только перед их началом.
 type MemoryStorage struct {
-	store map[string]string
+	mu sync.RWMutex
+	// код → url
+	store map[string]store.URL
+	// создатель → коды в порядке добавления
+	byCreator map[int][]string
+	// исходный url → код
+	byOriginal map[string]string
+
+	closed bool
+
+	// последний выданный идентификатор пользователя
+	lastUserID int64
+	// последний выданный номер кода
+	lastCodeNumber uint64
+
+	// логин → зарегистрированный пользователь
+	users map[string]store.User
+	// идентификаторы зарегистрированных пользователей
+	registered map[int]struct{}
+	// хеш → API ключ
+	apiKeys map[string]store.APIKey
+
+	clicks   map[string][]store.Click
+	clicksMu sync.RWMutex
 }
 
 // NewMemoryStorage инициализирует хранилище.
 func NewMemoryStorage() *MemoryStorage {
 
 	return &MemoryStorage{
-		store: make(map[string]string),
+		store:      make(map[string]store.URL),
+		byCreator:  make(map[int][]string),
+		byOriginal: make(map[string]string),
+		users:      make(map[string]store.User),
+		registered: make(map[int]struct{}),
+		apiKeys:    make(map[string]store.APIKey),
+		clicks:     make(map[string][]store.Click),
 	}
 }
 
 // WriteURL добавляет URL в хранилище.
-func (m *MemoryStorage) WriteURL(url *store.URL, id int, ssh *string) error {
-	data, err := json.Marshal(url)
-	if err != nil {
-		return fmt.Errorf("error from local storage. can't convert url - %s ", err)
+// Если исходный url уже сокращён, в url.Code записывается существующий код
+// и возвращается store.ErrConfilict. Url с истёкшим сроком помечается удалённым
+// и не мешает сократить исходный url заново.
+func (m *MemoryStorage) WriteURL(ctx context.Context, url *store.URL) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	m.store[*ssh] = string(data)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if code, ok := m.byOriginal[url.OriginalURL]; ok {
+		if existing := m.store[code]; !existing.Expired(time.Now()) {
+			url.Code = code
+			return store.ErrConfilict
+		}
+		m.markDeleted(code)
+	}
+
+	if _, ok := m.store[url.Code]; ok {
+		return &store.DuplicateCodeError{Code: url.Code}
+	}
+
+	m.store[url.Code] = *url
+	m.byCreator[url.Creator] = append(m.byCreator[url.Creator], url.Code)
+	m.byOriginal[url.OriginalURL] = url.Code
 	return nil
 }
 
 // ReadURL вычитывает url по ключу.
-func (m *MemoryStorage) ReadURL(url *store.URL, ssh string) error {
+func (m *MemoryStorage) ReadURL(ctx context.Context, url *store.URL, ssh string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.RLock()
 	value, ok := m.store[ssh]
+	m.mu.RUnlock()
 	if !ok {
-		return fmt.Errorf("error from local storage. url not found %s", ssh)
+		return store.ErrNotFound
 	}
 
-	if err := json.Unmarshal([]byte(value), url); err != nil {
-		return fmt.Errorf("error from local storage. can't convert url - %s ", err)
-	}
+	*url = value
 
 	if url.DeletedFlag {
 		return store.ErrDeleted
 	}
 
+	if url.Expired(time.Now()) {
+		return store.ErrExpired
+	}
+
 	return nil
 }
 
 // GetAllURL возвращает все сокращенные url пользователя.
-func (m *MemoryStorage) GetAllURL(id int) ([]store.URL, error) {
-	var userURL []store.URL
+func (m *MemoryStorage) GetAllURL(ctx context.Context, id int) ([]store.URL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	for _, value := range m.store {
-		var url store.URL
-		if err := json.Unmarshal([]byte(value), &url); err != nil {
-			return nil, fmt.Errorf("error from local storage. can't convert url - %s ", err)
-		}
-		if url.Creator == id {
-			userURL = append(userURL, url)
-		}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	codes := m.byCreator[id]
+	userURL := make([]store.URL, 0, len(codes))
+	for _, code := range codes {
+		userURL = append(userURL, m.store[code])
 	}
 	return userURL, nil
 }
 
 // DeleteURL удаляет url у текущего пользователя.
-func (m *MemoryStorage) DeleteURL(tasks []store.Task) error {
+func (m *MemoryStorage) DeleteURL(ctx context.Context, tasks []store.Task) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	fmt.Println("из функции удаления ", tasks)
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	for _, task := range tasks {
-		for key, value := range m.store {
-			var url store.URL
-			if err := json.Unmarshal([]byte(value), &url); err != nil {
-				return fmt.Errorf("error from local storage. can't convert url - %s ", err)
-			}
-
-			if url.ShortURL == task.Link && url.Creator == task.Creator {
-				url.DeletedFlag = true
-
-				data, err := json.Marshal(url)
-				if err != nil {
-					return fmt.Errorf("error from local storage. can't convert url - %s ", err)
-				}
-
-				fmt.Println(url)
-				m.store[key] = string(data)
-			}
+		url, ok := m.store[task.Code]
+		if !ok || url.Creator != task.Creator {
+			continue
 		}
+		m.markDeleted(task.Code)
 	}
 
 	return nil
+}
 
+// markDeleted помечает url удалённым и освобождает его исходный url.
+// Вызывается под m.mu.
+func (m *MemoryStorage) markDeleted(code string) {
+	url := m.store[code]
+	url.DeletedFlag = true
+	m.store[code] = url
+	if m.byOriginal[url.OriginalURL] == code {
+		delete(m.byOriginal, url.OriginalURL)
+	}
 }
 
-func (m *MemoryStorage) RewriteURL(url *store.URL) error {
-	return nil
+// DeleteExpiredURL помечает удалёнными url с истёкшим сроком жизни.
+func (m *MemoryStorage) DeleteExpiredURL(ctx context.Context, now time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	for code, url := range m.store {
+		if url.DeletedFlag || !url.Expired(now) {
+			continue
+		}
+
+		m.markDeleted(code)
+		deleted++
+	}
+
+	return deleted, nil
 }
 
+// Close помечает хранилище закрытым, данные при этом сохраняются.
 func (m *MemoryStorage) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
 	return nil
 }
 
-func (m *MemoryStorage) CheckPing() error {
+// CheckPing проверяет, что хранилище не закрыто.
+func (m *MemoryStorage) CheckPing(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return store.ErrClosed
+	}
 	return nil
 }
 
-func (m *MemoryStorage) Conflict(url *store.URL) (string, error) {
-	return "", nil
+// Conflict возвращает код, под которым уже сокращён исходный url.
+func (m *MemoryStorage) Conflict(ctx context.Context, url *store.URL) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	code, ok := m.byOriginal[url.OriginalURL]
+	if !ok {
+		return "", store.ErrNotFound
+	}
+	return code, nil
+}
+
+// NextUserID выдаёт следующий идентификатор пользователя.
+// Хранилище в памяти не переживает перезапуск, поэтому счётчик начинается с 1.
+func (m *MemoryStorage) NextUserID(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return int(atomic.AddInt64(&m.lastUserID, 1)), nil
 }
 
-func (m *MemoryStorage) InitID() (int, error) {
-	return -1, nil
+// NextCodeNumber выдаёт следующий номер кода.
+// Хранилище в памяти не переживает перезапуск, поэтому счётчик начинается с 1.
+func (m *MemoryStorage) NextCodeNumber(ctx context.Context) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return atomic.AddUint64(&m.lastCodeNumber, 1), nil
 }
@@ -0,0 +1,79 @@
+package memorystorage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	"github.com/AlexCorn999/short-url-service/internal/app/store/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+
+	m := NewMemoryStorage()
+
+	const writers = 8
+	const perWriter = 200
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(creator int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				code := fmt.Sprintf("%d-%d", creator, i)
+				url := store.NewURL(code, "http://origin.ru/"+code, creator)
+				assert.NoError(t, m.WriteURL(ctx, url))
+
+				var read store.URL
+				assert.NoError(t, m.ReadURL(ctx, &read, code))
+
+				_, err := m.GetAllURL(ctx, creator)
+				assert.NoError(t, err)
+
+				if i%2 == 0 {
+					assert.NoError(t, m.DeleteURL(ctx, []store.Task{*store.NewTask(code, creator)}))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for w := 0; w < writers; w++ {
+		urls, err := m.GetAllURL(ctx, w)
+		require.NoError(t, err)
+		require.Len(t, urls, perWriter)
+
+		deleted := 0
+		for _, url := range urls {
+			if url.DeletedFlag {
+				deleted++
+			}
+		}
+		assert.Equal(t, perWriter/2, deleted)
+	}
+}
+
+func TestGetAllURLUsesCreatorIndex(t *testing.T) {
+	ctx := context.Background()
+
+	m := NewMemoryStorage()
+	require.NoError(t, m.WriteURL(ctx, store.NewURL("a", "http://one.ru", 1)))
+	require.NoError(t, m.WriteURL(ctx, store.NewURL("b", "http://two.ru", 2)))
+
+	urls, err := m.GetAllURL(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "http://one.ru", urls[0].OriginalURL)
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Database {
+		return NewMemoryStorage()
+	})
+}
@@ -0,0 +1,65 @@
+package memorystorage
+
+import (
+	"context"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+)
+
+// CreateUser сохраняет пользователя в памяти.
+func (m *MemoryStorage) CreateUser(ctx context.Context, user *store.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[user.Login]; ok {
+		return store.ErrUserExists
+	}
+
+	m.users[user.Login] = *user
+	m.registered[user.ID] = struct{}{}
+	return nil
+}
+
+// UserByLogin возвращает пользователя по логину.
+func (m *MemoryStorage) UserByLogin(ctx context.Context, login string) (store.User, error) {
+	if err := ctx.Err(); err != nil {
+		return store.User{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[login]
+	if !ok {
+		return store.User{}, store.ErrNotFound
+	}
+	return user, nil
+}
+
+// ClaimURLs передаёт ссылки анонимного пользователя from пользователю to.
+func (m *MemoryStorage) ClaimURLs(ctx context.Context, from, to int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.registered[from]; ok || from == to {
+		return 0, nil
+	}
+
+	codes := m.byCreator[from]
+	for _, code := range codes {
+		url := m.store[code]
+		url.Creator = to
+		m.store[code] = url
+	}
+	m.byCreator[to] = append(m.byCreator[to], codes...)
+	delete(m.byCreator, from)
+	return len(codes), nil
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/logger"
+	"github.com/go-chi/chi"
+)
+
+// метка маршрута для запросов, не подошедших ни к одному маршруту
+const unmatchedRoute = "unmatched"
+
+// Middleware считает запросы и их длительность по шаблону маршрута chi,
+// чтобы коды ссылок не попадали в метки. Подключается к роутеру chi
+// через Use, шаблон известен после обработки запроса.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &logger.LoggingResponseWriter{ResponseWriter: w, ResponseData: &logger.ResponseData{}}
+
+		next.ServeHTTP(sw, r)
+
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := sw.ResponseData.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		labels := []string{route, r.Method, strconv.Itoa(status)}
+		m.requests.WithLabelValues(labels...).Inc()
+		m.requestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	})
+}
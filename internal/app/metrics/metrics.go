@@ -0,0 +1,148 @@
+// Package metrics собирает метрики сервиса в формате Prometheus.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// префикс имён метрик сервиса
+const namespace = "shortener"
+
+// Результаты перехода по сокращённой ссылке.
+const (
+	RedirectOK       = "redirect"
+	RedirectNotFound = "not_found"
+	RedirectGone     = "gone"
+	RedirectBlocked  = "blocked"
+	RedirectError    = "error"
+)
+
+// Metrics метрики сервиса в собственном реестре.
+// Методы можно вызывать у nil, тогда метрики не собираются.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+
+	deleteQueueDepth prometheus.Gauge
+	deleteBatchSize  prometheus.Histogram
+	deleteFailures   prometheus.Counter
+
+	redirects *prometheus.CounterVec
+}
+
+// New создаёт метрики и регистрирует их вместе с метриками процесса и Go.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests by route pattern, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by route pattern, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "operation_duration_seconds",
+			Help:      "Storage operation latency by backend and operation.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"backend", "operation"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "errors_total",
+			Help:      "Failed storage operations by backend and operation.",
+		}, []string{"backend", "operation"}),
+		deleteQueueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "delete_queue",
+			Name:      "depth",
+			Help:      "Delete tasks waiting for the next batch.",
+		}),
+		deleteBatchSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "delete_queue",
+			Name:      "batch_size",
+			Help:      "Delete tasks per storage batch.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 7),
+		}),
+		deleteFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "delete_queue",
+			Name:      "failures_total",
+			Help:      "Delete batches the storage failed to apply.",
+		}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Short URL lookups by result.",
+		}, []string{"result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.storageDuration,
+		m.storageErrors,
+		m.deleteQueueDepth,
+		m.deleteBatchSize,
+		m.deleteFailures,
+		m.redirects,
+	)
+	return m
+}
+
+// Registry возвращает реестр метрик.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler отдаёт метрики в текстовом формате Prometheus.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Redirect учитывает переход по сокращённой ссылке с результатом result.
+func (m *Metrics) Redirect(result string) {
+	if m == nil {
+		return
+	}
+	m.redirects.WithLabelValues(result).Inc()
+}
+
+// QueueDepth реализует worker.DeleteObserver.
+func (m *Metrics) QueueDepth(n int) {
+	if m == nil {
+		return
+	}
+	m.deleteQueueDepth.Set(float64(n))
+}
+
+// DeleteBatch реализует worker.DeleteObserver.
+func (m *Metrics) DeleteBatch(size int, err error) {
+	if m == nil {
+		return
+	}
+	m.deleteBatchSize.Observe(float64(size))
+	if err != nil {
+		m.deleteFailures.Inc()
+	}
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/memorystorage"
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareUsesRoutePattern(t *testing.T) {
+	m := New()
+	router := chi.NewRouter()
+	router.Use(m.Middleware)
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+	router.Post("/api/shorten", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	for _, target := range []string{"/abc", "/def"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/shorten", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a/b/c", nil))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("/{id}", http.MethodGet, "307")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("/api/shorten", http.MethodPost, "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues(unmatchedRoute, http.MethodGet, "404")))
+	// коды ссылок не попадают в метки
+	assert.Equal(t, 3, testutil.CollectAndCount(m.requests))
+	assert.Equal(t, 3, testutil.CollectAndCount(m.requestDuration))
+}
+
+func TestWrapDatabase(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	db := WrapDatabase(memorystorage.NewMemoryStorage(), "local", m)
+
+	require.NoError(t, db.WriteURL(ctx, store.NewURL("a", "http://a.ru", 1)))
+	// уже сокращённая и ненайденная ссылки не считаются ошибками
+	assert.ErrorIs(t, db.WriteURL(ctx, store.NewURL("b", "http://a.ru", 1)), store.ErrConfilict)
+	var url store.URL
+	assert.ErrorIs(t, db.ReadURL(ctx, &url, "missing"), store.ErrNotFound)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, db.ReadURL(canceled, &url, "a"))
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.storageDuration))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.storageErrors.WithLabelValues("local", "write_url")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.storageErrors.WithLabelValues("local", "read_url")))
+
+	wrapped, ok := db.(*Database)
+	require.True(t, ok)
+	assert.IsType(t, &memorystorage.MemoryStorage{}, wrapped.Unwrap())
+
+	// без метрик хранилище не оборачивается
+	plain := memorystorage.NewMemoryStorage()
+	assert.Same(t, plain, WrapDatabase(plain, "local", nil))
+}
+
+func TestDeleteQueueAndRedirects(t *testing.T) {
+	m := New()
+	m.QueueDepth(3)
+	m.DeleteBatch(3, nil)
+	m.DeleteBatch(2, errors.New("storage is down"))
+	m.Redirect(RedirectOK)
+	m.Redirect(RedirectOK)
+	m.Redirect(RedirectGone)
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.deleteQueueDepth))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.deleteFailures))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.redirects.WithLabelValues(RedirectOK)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.redirects.WithLabelValues(RedirectGone)))
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.True(t, strings.Contains(body, "shortener_delete_queue_batch_size_count 2"), body)
+	assert.True(t, strings.Contains(body, "go_goroutines"), body)
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.Redirect(RedirectOK)
+	m.QueueDepth(1)
+	m.DeleteBatch(1, nil)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	assert.NotNil(t, m.Middleware(handler))
+}
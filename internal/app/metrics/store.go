@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+)
+
+// Database оборачивает store.Database и измеряет длительность и ошибки операций.
+// Ожидаемые исходы вроде ненайденной или уже сокращённой ссылки ошибками не считаются.
+type Database struct {
+	store.Database
+	metrics *Metrics
+	backend string
+}
+
+// WrapDatabase возвращает db с метриками для хранилища backend.
+// Без метрик db возвращается как есть.
+func WrapDatabase(db store.Database, backend string, m *Metrics) store.Database {
+	if m == nil {
+		return db
+	}
+	return &Database{Database: db, metrics: m, backend: backend}
+}
+
+// Unwrap возвращает исходное хранилище.
+func (d *Database) Unwrap() store.Database {
+	return d.Database
+}
+
+// observe учитывает операцию, начатую в start.
+func (d *Database) observe(operation string, start time.Time, err error) {
+	d.metrics.storageDuration.WithLabelValues(d.backend, operation).Observe(time.Since(start).Seconds())
+	if store.Failed(err) {
+		d.metrics.storageErrors.WithLabelValues(d.backend, operation).Inc()
+	}
+}
+
+func (d *Database) WriteURL(ctx context.Context, url *store.URL) error {
+	start := time.Now()
+	err := d.Database.WriteURL(ctx, url)
+	d.observe("write_url", start, err)
+	return err
+}
+
+func (d *Database) ReadURL(ctx context.Context, url *store.URL, code string) error {
+	start := time.Now()
+	err := d.Database.ReadURL(ctx, url, code)
+	d.observe("read_url", start, err)
+	return err
+}
+
+func (d *Database) GetAllURL(ctx context.Context, id int) ([]store.URL, error) {
+	start := time.Now()
+	urls, err := d.Database.GetAllURL(ctx, id)
+	d.observe("get_all_url", start, err)
+	return urls, err
+}
+
+func (d *Database) Conflict(ctx context.Context, url *store.URL) (string, error) {
+	start := time.Now()
+	code, err := d.Database.Conflict(ctx, url)
+	d.observe("conflict", start, err)
+	return code, err
+}
+
+func (d *Database) DeleteURL(ctx context.Context, tasks []store.Task) error {
+	start := time.Now()
+	err := d.Database.DeleteURL(ctx, tasks)
+	d.observe("delete_url", start, err)
+	return err
+}
+
+func (d *Database) NextUserID(ctx context.Context) (int, error) {
+	start := time.Now()
+	id, err := d.Database.NextUserID(ctx)
+	d.observe("next_user_id", start, err)
+	return id, err
+}
+
+func (d *Database) NextCodeNumber(ctx context.Context) (uint64, error) {
+	start := time.Now()
+	n, err := d.Database.NextCodeNumber(ctx)
+	d.observe("next_code_number", start, err)
+	return n, err
+}
+
+func (d *Database) CheckPing(ctx context.Context) error {
+	start := time.Now()
+	err := d.Database.CheckPing(ctx)
+	d.observe("ping", start, err)
+	return err
+}
+
+func (d *Database) DeleteExpiredURL(ctx context.Context, now time.Time) (int, error) {
+	start := time.Now()
+	n, err := d.Database.DeleteExpiredURL(ctx, now)
+	d.observe("delete_expired_url", start, err)
+	return n, err
+}
@@ -0,0 +1,181 @@
+package policy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// префикс строки блок-листа с регулярным выражением для всей ссылки
+const regexPrefix = "regex:"
+
+// rules разобранный блок-лист.
+type rules struct {
+	domains  map[string]struct{}
+	patterns []*regexp.Regexp
+}
+
+// parseRules разбирает блок-лист: по домену в строке (запрещает и поддомены)
+// или regex:<выражение> для всей ссылки. Пустые строки и строки с # пропускаются.
+func parseRules(data []byte) (*rules, error) {
+	r := &rules{domains: make(map[string]struct{})}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, regexPrefix) {
+			pattern, err := regexp.Compile(strings.TrimSpace(strings.TrimPrefix(text, regexPrefix)))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			r.patterns = append(r.patterns, pattern)
+			continue
+		}
+
+		r.domains[strings.TrimSuffix(strings.ToLower(text), ".")] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// match возвращает правило, под которое попадает ссылка.
+func (r *rules) match(rawURL string) (string, bool) {
+	// домен и все его родительские домены
+	for host := hostOf(rawURL); host != ""; {
+		if _, ok := r.domains[host]; ok {
+			return "domain " + host, true
+		}
+		dot := strings.IndexByte(host, '.')
+		if dot < 0 {
+			break
+		}
+		host = host[dot+1:]
+	}
+
+	for _, pattern := range r.patterns {
+		if pattern.MatchString(rawURL) {
+			return "pattern " + pattern.String(), true
+		}
+	}
+	return "", false
+}
+
+// Blocklist запрещает ссылки по блок-листу из файла.
+// Файл перечитывается при изменении, пока запущен Watch.
+type Blocklist struct {
+	path   string
+	logger *log.Logger
+
+	mu      sync.RWMutex
+	rules   *rules
+	modTime time.Time
+	size    int64
+
+	// закрывается, когда Watch остановлен, nil без Watch
+	done chan struct{}
+}
+
+// NewBlocklist загружает блок-лист из файла path.
+func NewBlocklist(path string, logger *log.Logger) (*Blocklist, error) {
+	b := &Blocklist{path: path, logger: logger}
+	if _, err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Check запрещает ссылки из блок-листа.
+func (b *Blocklist) Check(ctx context.Context, rawURL string) error {
+	b.mu.RLock()
+	rules := b.rules
+	b.mu.RUnlock()
+
+	if rule, ok := rules.match(rawURL); ok {
+		return &BlockedError{URL: rawURL, Reason: "blocklist " + rule}
+	}
+	return nil
+}
+
+// Reload перечитывает файл, если он изменился, и сообщает, был ли он перечитан.
+// При ошибке разбора остаётся прежний блок-лист.
+func (b *Blocklist) Reload() (bool, error) {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return false, fmt.Errorf("error from blocklist. can't read file - %w", err)
+	}
+
+	b.mu.RLock()
+	unchanged := b.rules != nil && info.ModTime().Equal(b.modTime) && info.Size() == b.size
+	b.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return false, fmt.Errorf("error from blocklist. can't read file - %w", err)
+	}
+	rules, err := parseRules(data)
+	if err != nil {
+		return false, fmt.Errorf("error from blocklist. can't parse %s - %w", b.path, err)
+	}
+
+	b.mu.Lock()
+	b.rules, b.modTime, b.size = rules, info.ModTime(), info.Size()
+	b.mu.Unlock()
+	return true, nil
+}
+
+// Watch проверяет файл на изменения через каждые interval до отмены контекста.
+func (b *Blocklist) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	b.done = make(chan struct{})
+
+	go func() {
+		defer close(b.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reloaded, err := b.Reload()
+				if err != nil {
+					b.logger.Error(err)
+					continue
+				}
+				if reloaded {
+					b.logger.Info("blocklist reloaded")
+				}
+			}
+		}
+	}()
+}
+
+// Wait дожидается остановки Watch после отмены контекста.
+// Без запущенного Watch возвращается сразу.
+func (b *Blocklist) Wait(ctx context.Context) error {
+	if b.done == nil {
+		return nil
+	}
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("blocklist watcher: %w", ctx.Err())
+	}
+}
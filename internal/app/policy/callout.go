@@ -0,0 +1,157 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// максимальное число запомненных решений внешнего сервиса
+const maxCacheEntries = 10000
+
+// запрос к сервису репутации
+type calloutRequest struct {
+	URL string `json:"url"`
+}
+
+// ответ сервиса репутации
+type calloutResponse struct {
+	Blocked bool   `json:"blocked"`
+	Reason  string `json:"reason"`
+}
+
+type verdict struct {
+	blocked bool
+	reason  string
+	expires time.Time
+}
+
+// HTTPOptions настройки обращения к сервису репутации.
+type HTTPOptions struct {
+	// адрес, на который отправляется POST {"url":"<url>"}, ответ {"blocked":bool,"reason":"<reason>"}
+	Endpoint string
+	Timeout  time.Duration
+	// сколько помнить ответ сервиса, 0 отключает кеш
+	CacheTTL time.Duration
+	// при недоступности сервиса ссылка разрешается
+	FailOpen bool
+	Client   *http.Client
+}
+
+// HTTPCallout проверяет ссылки во внешнем сервисе репутации.
+type HTTPCallout struct {
+	opts HTTPOptions
+	now  func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]verdict
+}
+
+// NewHTTPCallout возвращает политику, обращающуюся к opts.Endpoint.
+func NewHTTPCallout(opts HTTPOptions) *HTTPCallout {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	return &HTTPCallout{
+		opts:  opts,
+		now:   time.Now,
+		cache: make(map[string]verdict),
+	}
+}
+
+// Check запрашивает решение о ссылке у сервиса репутации.
+func (h *HTTPCallout) Check(ctx context.Context, rawURL string) error {
+	if v, ok := h.cached(rawURL); ok {
+		return v.err(rawURL)
+	}
+
+	v, err := h.ask(ctx, rawURL)
+	if err != nil {
+		if h.opts.FailOpen {
+			return nil
+		}
+		return err
+	}
+
+	h.remember(rawURL, v)
+	return v.err(rawURL)
+}
+
+func (v verdict) err(rawURL string) error {
+	if v.blocked {
+		return &BlockedError{URL: rawURL, Reason: v.reason}
+	}
+	return nil
+}
+
+func (h *HTTPCallout) ask(ctx context.Context, rawURL string) (verdict, error) {
+	if h.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.opts.Timeout)
+		defer cancel()
+	}
+
+	body, err := json.Marshal(calloutRequest{URL: rawURL})
+	if err != nil {
+		return verdict{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.opts.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return verdict{}, fmt.Errorf("error from url policy. %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.opts.Client.Do(req)
+	if err != nil {
+		return verdict{}, fmt.Errorf("error from url policy. %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return verdict{}, fmt.Errorf("error from url policy. unexpected status %d", resp.StatusCode)
+	}
+
+	var result calloutResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return verdict{}, fmt.Errorf("error from url policy. can't decode response - %w", err)
+	}
+	return verdict{blocked: result.Blocked, reason: result.Reason}, nil
+}
+
+func (h *HTTPCallout) cached(rawURL string) (verdict, bool) {
+	if h.opts.CacheTTL <= 0 {
+		return verdict{}, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	v, ok := h.cache[rawURL]
+	if !ok || !h.now().Before(v.expires) {
+		return verdict{}, false
+	}
+	return v, true
+}
+
+func (h *HTTPCallout) remember(rawURL string, v verdict) {
+	if h.opts.CacheTTL <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// кеш сбрасывается целиком, чтобы не расти без ограничений
+	if len(h.cache) >= maxCacheEntries {
+		h.cache = make(map[string]verdict)
+	}
+	v.expires = h.now().Add(h.opts.CacheTTL)
+	h.cache[rawURL] = v
+}
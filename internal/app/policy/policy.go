@@ -0,0 +1,57 @@
+// Package policy проверяет исходные ссылки по блок-листам и внешним сервисам репутации.
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var ErrBlocked = errors.New("url is blocked")
+
+// BlockedError сообщает, что ссылка запрещена политикой.
+type BlockedError struct {
+	URL    string
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	if e.Reason == "" {
+		return ErrBlocked.Error()
+	}
+	return fmt.Sprintf("%s: %s", ErrBlocked, e.Reason)
+}
+
+func (e *BlockedError) Is(target error) bool {
+	return target == ErrBlocked
+}
+
+// URLPolicy решает, можно ли сокращать ссылку и переходить по ней.
+// Check возвращает nil для разрешённой ссылки, ошибку с ErrBlocked для запрещённой
+// и другую ошибку, если решение принять не удалось.
+type URLPolicy interface {
+	Check(ctx context.Context, rawURL string) error
+}
+
+// Chain проверяет ссылку всеми политиками по порядку до первой ошибки.
+type Chain []URLPolicy
+
+func (c Chain) Check(ctx context.Context, rawURL string) error {
+	for _, p := range c {
+		if err := p.Check(ctx, rawURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostOf возвращает хост ссылки в нижнем регистре без завершающей точки.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
@@ -0,0 +1,145 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocklist(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# phishing\nEvil.com\n\nregex:/login\\.php$\n"), 0o600))
+
+	b, err := NewBlocklist(path, log.New())
+	require.NoError(t, err)
+
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{"http://evil.com", true},
+		{"https://login.EVIL.com/path", true},
+		{"http://notevil.com", false},
+		{"http://good.ru/login.php", true},
+		{"http://good.ru/login.php?next=1", false},
+	}
+
+	for _, tc := range tests {
+		err := b.Check(ctx, tc.url)
+		if tc.blocked {
+			assert.ErrorIs(t, err, ErrBlocked, tc.url)
+		} else {
+			assert.NoError(t, err, tc.url)
+		}
+	}
+
+	// изменённый файл перечитывается, ошибочный файл не заменяет рабочий список
+	require.NoError(t, os.WriteFile(path, []byte("good.ru\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	reloaded, err := b.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.NoError(t, b.Check(ctx, "http://evil.com"))
+	assert.ErrorIs(t, b.Check(ctx, "http://good.ru"), ErrBlocked)
+
+	require.NoError(t, os.WriteFile(path, []byte("regex:(\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second)))
+	_, err = b.Reload()
+	assert.Error(t, err)
+	assert.ErrorIs(t, b.Check(ctx, "http://good.ru"), ErrBlocked)
+
+	reloaded, err = b.Reload()
+	assert.Error(t, err)
+	assert.False(t, reloaded)
+}
+
+func TestBlocklistWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("evil.com\n"), 0o600))
+	b, err := NewBlocklist(path, log.New())
+	require.NoError(t, err)
+
+	// без Watch ждать нечего
+	assert.NoError(t, b.Wait(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.Watch(ctx, time.Minute)
+	deadline, deadlineCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer deadlineCancel()
+	assert.ErrorIs(t, b.Wait(deadline), context.DeadlineExceeded)
+
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	assert.NoError(t, b.Wait(waitCtx))
+}
+
+func TestHTTPCallout(t *testing.T) {
+	ctx := context.Background()
+
+	var calls int32
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		var req calloutRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		json.NewEncoder(w).Encode(calloutResponse{
+			Blocked: req.URL == "http://phish.ru",
+			Reason:  "phishing",
+		})
+	}))
+	defer stub.Close()
+
+	h := NewHTTPCallout(HTTPOptions{Endpoint: stub.URL, Timeout: time.Second, CacheTTL: time.Minute})
+
+	err := h.Check(ctx, "http://phish.ru")
+	var blocked *BlockedError
+	require.True(t, errors.As(err, &blocked))
+	assert.Equal(t, "phishing", blocked.Reason)
+	assert.NoError(t, h.Check(ctx, "http://good.ru"))
+
+	// повторная проверка берётся из кеша
+	assert.ErrorIs(t, h.Check(ctx, "http://phish.ru"), ErrBlocked)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestHTTPCalloutUnavailable(t *testing.T) {
+	ctx := context.Background()
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer stub.Close()
+
+	closed := NewHTTPCallout(HTTPOptions{Endpoint: stub.URL})
+	err := closed.Check(ctx, "http://good.ru")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrBlocked)
+
+	open := NewHTTPCallout(HTTPOptions{Endpoint: stub.URL, FailOpen: true})
+	assert.NoError(t, open.Check(ctx, "http://good.ru"))
+}
+
+func TestChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("evil.com\n"), 0o600))
+	b, err := NewBlocklist(path, log.New())
+	require.NoError(t, err)
+
+	chain := Chain{b}
+	assert.ErrorIs(t, chain.Check(context.Background(), "http://evil.com"), ErrBlocked)
+	assert.NoError(t, chain.Check(context.Background(), "http://good.com"))
+	assert.NoError(t, Chain(nil).Check(context.Background(), "http://evil.com"))
+}
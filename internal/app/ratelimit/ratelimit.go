@@ -0,0 +1,174 @@
+// Package ratelimit ограничивает частоту запросов по алгоритму token bucket.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Группы маршрутов с отдельными ограничениями.
+const (
+	GroupCreate   = "create"
+	GroupRedirect = "redirect"
+	GroupDelete   = "delete"
+)
+
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+// Limit ограничение: Burst запросов подряд и пополнение Rate запросов в секунду.
+// Нулевое ограничение отключено.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled сообщает, что ограничение включено.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Refill возвращает время, за которое пустая корзина заполняется целиком.
+// Корзина, не менявшаяся дольше, не отличается от отсутствующей.
+func (l Limit) Refill() time.Duration {
+	if !l.Enabled() {
+		return 0
+	}
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+// ParseLimit разбирает ограничение вида N/s, N/m или N/h.
+// Пустая строка, 0 и off отключают ограничение.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" || s == "off" {
+		return Limit{}, nil
+	}
+
+	count, unit, found := strings.Cut(s, "/")
+	if !found {
+		return Limit{}, fmt.Errorf("%w: %q must be N/s, N/m or N/h", ErrInvalidLimit, s)
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("%w: %q must have a positive count", ErrInvalidLimit, s)
+	}
+
+	var period time.Duration
+	switch unit {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("%w: %q must be N/s, N/m or N/h", ErrInvalidLimit, s)
+	}
+
+	return Limit{Rate: float64(n) / period.Seconds(), Burst: n}, nil
+}
+
+// Bucket состояние корзины токенов. Нулевая корзина считается полной.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Decision результат проверки запроса.
+type Decision struct {
+	Allowed bool
+	// через сколько появится следующий токен, если запрос отклонён
+	RetryAfter time.Duration
+}
+
+// Take пополняет корзину к моменту now и забирает токен, если он есть.
+func Take(b Bucket, l Limit, now time.Time) (Bucket, Decision) {
+	burst := float64(l.Burst)
+	tokens := burst
+	if !b.Updated.IsZero() {
+		elapsed := now.Sub(b.Updated).Seconds()
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		tokens = math.Min(burst, b.Tokens+elapsed*l.Rate)
+	}
+
+	if tokens >= 1 {
+		return Bucket{Tokens: tokens - 1, Updated: now}, Decision{Allowed: true}
+	}
+
+	wait := time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+	return Bucket{Tokens: tokens, Updated: now}, Decision{RetryAfter: wait}
+}
+
+// Limiter проверяет запросы по ключу.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Decision, error)
+}
+
+// как часто Memory удаляет заполнившиеся корзины
+const sweepInterval = time.Minute
+
+type entry struct {
+	bucket Bucket
+	// момент, когда корзина снова заполнится и её можно удалить
+	full time.Time
+}
+
+// Memory хранит корзины в памяти одного экземпляра сервиса.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemory возвращает ограничитель в памяти.
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: make(map[string]entry),
+		now:     time.Now,
+	}
+}
+
+// Allow забирает токен из корзины key.
+func (m *Memory) Allow(ctx context.Context, key string, limit Limit) (Decision, error) {
+	if err := ctx.Err(); err != nil {
+		return Decision{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	bucket, decision := Take(m.buckets[key].bucket, limit, now)
+	missing := float64(limit.Burst) - bucket.Tokens
+	m.buckets[key] = entry{
+		bucket: bucket,
+		full:   now.Add(time.Duration(missing / limit.Rate * float64(time.Second))),
+	}
+	return decision, nil
+}
+
+// sweep удаляет заполнившиеся корзины, они не отличаются от отсутствующих.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, e := range m.buckets {
+		if !now.Before(e.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Limit
+		err   bool
+	}{
+		{"10/s", Limit{Rate: 10, Burst: 10}, false},
+		{"60/m", Limit{Rate: 1, Burst: 60}, false},
+		{"3600/h", Limit{Rate: 1, Burst: 3600}, false},
+		{"", Limit{}, false},
+		{"off", Limit{}, false},
+		{"10", Limit{}, true},
+		{"-1/s", Limit{}, true},
+		{"10/d", Limit{}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			limit, err := ParseLimit(tc.value)
+			if tc.err {
+				assert.ErrorIs(t, err, ErrInvalidLimit)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, limit)
+		})
+	}
+}
+
+func TestLimitRefill(t *testing.T) {
+	assert.Equal(t, time.Minute, Limit{Rate: 1, Burst: 60}.Refill())
+	assert.Equal(t, time.Hour, Limit{Rate: 1, Burst: 3600}.Refill())
+	assert.Zero(t, Limit{}.Refill())
+}
+
+func TestTake(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Now()
+
+	var bucket Bucket
+	var decision Decision
+	for i := 0; i < 2; i++ {
+		bucket, decision = Take(bucket, limit, now)
+		require.True(t, decision.Allowed)
+	}
+
+	bucket, decision = Take(bucket, limit, now.Add(500*time.Millisecond))
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 500*time.Millisecond, decision.RetryAfter)
+
+	// за секунду появляется один токен
+	bucket, decision = Take(bucket, limit, now.Add(1500*time.Millisecond))
+	assert.True(t, decision.Allowed)
+	_, decision = Take(bucket, limit, now.Add(1500*time.Millisecond))
+	assert.False(t, decision.Allowed)
+
+	// корзина не переполняется
+	bucket, _ = Take(bucket, limit, now.Add(time.Hour))
+	assert.Equal(t, float64(1), bucket.Tokens)
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	limit := Limit{Rate: 1, Burst: 1}
+	decision, err := m.Allow(ctx, "a", limit)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	decision, err = m.Allow(ctx, "a", limit)
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, time.Second, decision.RetryAfter)
+
+	// у других ключей свои корзины
+	decision, err = m.Allow(ctx, "b", limit)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	// заполнившиеся корзины удаляются
+	now = now.Add(2 * sweepInterval)
+	_, err = m.Allow(ctx, "c", limit)
+	require.NoError(t, err)
+	assert.Len(t, m.buckets, 1)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = m.Allow(canceled, "a", limit)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,60 @@
+// Package requestid присваивает запросам идентификатор для ответов и логов.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header заголовок с идентификатором запроса.
+const Header = "X-Request-ID"
+
+// максимальная длина идентификатора, принятого от клиента
+const maxLength = 64
+
+// key ключ идентификатора запроса в контексте.
+type key struct{}
+
+// Middleware берёт идентификатор из заголовка X-Request-ID или создаёт новый,
+// сохраняет его в контексте запроса и возвращает в заголовке ответа.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = generate()
+		}
+
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), key{}, id)))
+	})
+}
+
+// FromContext возвращает идентификатор запроса или пустую строку.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(key{}).(string)
+	return id
+}
+
+// valid пропускает только короткие идентификаторы из печатных символов,
+// чтобы значение клиента нельзя было использовать для подделки логов.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func generate() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
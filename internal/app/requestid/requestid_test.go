@@ -0,0 +1,47 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"client id", "abc-123", true},
+		{"missing", "", false},
+		{"too long", strings.Repeat("a", 65), false},
+		{"control characters", "abc\ninjected", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.incoming != "" {
+				req.Header.Set(Header, tc.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.NotEmpty(t, seen)
+			assert.Equal(t, seen, w.Header().Get(Header))
+			if tc.keep {
+				assert.Equal(t, tc.incoming, seen)
+			} else {
+				assert.NotEqual(t, tc.incoming, seen)
+			}
+		})
+	}
+}
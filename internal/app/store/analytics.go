@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Click сведения о переходе по короткой ссылке.
+type Click struct {
+	Code      string    `json:"code"`
+	Time      time.Time `json:"time"`
+	Referrer  string    `json:"referrer"`
+	UserAgent string    `json:"user_agent"`
+	IPHash    string    `json:"ip_hash"`
+}
+
+// ClickCount количество переходов за период.
+type ClickCount struct {
+	Period time.Time `json:"period"`
+	Clicks int       `json:"clicks"`
+}
+
+// ClickStats статистика переходов по короткой ссылке.
+type ClickStats struct {
+	TotalClicks    int          `json:"total_clicks"`
+	UniqueVisitors int          `json:"unique_visitors"`
+	Daily          []ClickCount `json:"daily"`
+	Hourly         []ClickCount `json:"hourly"`
+}
+
+// Analytics общая реализация хранилища статистики переходов.
+type Analytics interface {
+	WriteClicks(ctx context.Context, clicks []Click) error
+	ClickStats(ctx context.Context, code string) (ClickStats, error)
+}
+
+// AggregateClicks считает статистику по списку переходов.
+// Временные ряды строятся в UTC и отсортированы по возрастанию периода.
+func AggregateClicks(clicks []Click) ClickStats {
+	stats := ClickStats{
+		TotalClicks: len(clicks),
+		Daily:       []ClickCount{},
+		Hourly:      []ClickCount{},
+	}
+
+	visitors := make(map[string]struct{})
+	daily := make(map[time.Time]int)
+	hourly := make(map[time.Time]int)
+	for _, click := range clicks {
+		visitors[click.IPHash] = struct{}{}
+		t := click.Time.UTC()
+		daily[t.Truncate(24*time.Hour)]++
+		hourly[t.Truncate(time.Hour)]++
+	}
+
+	stats.UniqueVisitors = len(visitors)
+	stats.Daily = appendCounts(stats.Daily, daily)
+	stats.Hourly = appendCounts(stats.Hourly, hourly)
+	return stats
+}
+
+func appendCounts(counts []ClickCount, periods map[time.Time]int) []ClickCount {
+	for period, clicks := range periods {
+		counts = append(counts, ClickCount{Period: period, Clicks: clicks})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Period.Before(counts[j].Period)
+	})
+	return counts
+}
+
+// WriteClicks сохраняет переходы в базу данных.
+func (d *Postgres) WriteClicks(ctx context.Context, clicks []Click) error {
+	tx, err := d.store.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error from postgres. can't add clicks to db - %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, "insert into clicks (code, clicked_at, referrer, user_agent, ip_hash) values ($1, $2, $3, $4, $5)")
+	if err != nil {
+		return fmt.Errorf("error from postgres. can't add clicks to db - %w", err)
+	}
+	defer stmt.Close()
+
+	for _, click := range clicks {
+		if _, err := stmt.ExecContext(ctx, click.Code, click.Time, click.Referrer, click.UserAgent, click.IPHash); err != nil {
+			return fmt.Errorf("error from postgres. can't add clicks to db - %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error from postgres. can't add clicks to db - %w", err)
+	}
+	return nil
+}
+
+// ClickStats возвращает статистику переходов по коду.
+func (d *Postgres) ClickStats(ctx context.Context, code string) (ClickStats, error) {
+	stats := ClickStats{
+		Daily:  []ClickCount{},
+		Hourly: []ClickCount{},
+	}
+
+	err := d.store.QueryRowContext(ctx, "select count(*), count(distinct ip_hash) from clicks where code = $1", code).Scan(&stats.TotalClicks, &stats.UniqueVisitors)
+	if err != nil {
+		return stats, fmt.Errorf("error from postgres. can't read clicks from db - %w", err)
+	}
+
+	if stats.Daily, err = d.clickSeries(ctx, code, "day"); err != nil {
+		return stats, err
+	}
+	if stats.Hourly, err = d.clickSeries(ctx, code, "hour"); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// clickSeries возвращает количество переходов по периодам длиной unit.
+func (d *Postgres) clickSeries(ctx context.Context, code, unit string) ([]ClickCount, error) {
+	counts := []ClickCount{}
+	rows, err := d.store.QueryContext(ctx, "select date_trunc($1, clicked_at at time zone 'UTC') as period, count(*) from clicks where code = $2 group by period order by period", unit, code)
+	if err != nil {
+		return nil, fmt.Errorf("error from postgres. can't read clicks from db - %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var count ClickCount
+		if err := rows.Scan(&count.Period, &count.Clicks); err != nil {
+			return nil, fmt.Errorf("error from postgres. can't read clicks from db - %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error from postgres. can't read clicks from db - %w", err)
+	}
+	return counts, nil
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APIKey ключ доступа к API. Хранится только хеш ключа.
+type APIKey struct {
+	ID        string    `json:"id"`
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIKeys общая реализация хранилища API ключей.
+type APIKeys interface {
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	// APIKeyByHash возвращает ключ по хешу или ErrNotFound.
+	APIKeyByHash(ctx context.Context, hash string) (APIKey, error)
+	// ListAPIKeys возвращает ключи пользователя в порядке создания.
+	ListAPIKeys(ctx context.Context, userID int) ([]APIKey, error)
+	// RevokeAPIKey удаляет ключ пользователя. Для чужого или отсутствующего ключа возвращается ErrNotFound.
+	RevokeAPIKey(ctx context.Context, userID int, id string) error
+}
+
+// CreateAPIKey сохраняет ключ в базу данных.
+func (d *Postgres) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	_, err := d.store.ExecContext(ctx, "insert into api_keys (id, user_id, name, key_hash, scopes, created_at) values ($1, $2, $3, $4, $5, $6)",
+		key.ID, key.UserID, key.Name, key.Hash, strings.Join(key.Scopes, ","), key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error from postgres. can't add api key to db - %w", err)
+	}
+	return nil
+}
+
+// APIKeyByHash возвращает ключ по хешу.
+func (d *Postgres) APIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	row := d.store.QueryRowContext(ctx, "select id, user_id, name, key_hash, scopes, created_at from api_keys where key_hash = $1", hash)
+	key, err := scanAPIKey(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return key, ErrNotFound
+		}
+		return key, fmt.Errorf("error from postgres. can't read api key from db - %w", err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys возвращает ключи пользователя.
+func (d *Postgres) ListAPIKeys(ctx context.Context, userID int) ([]APIKey, error) {
+	rows, err := d.store.QueryContext(ctx, "select id, user_id, name, key_hash, scopes, created_at from api_keys where user_id = $1 order by created_at, id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error from postgres. can't read api keys from db - %w", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error from postgres. can't read api keys from db - %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error from postgres. can't read api keys from db - %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey удаляет ключ пользователя.
+func (d *Postgres) RevokeAPIKey(ctx context.Context, userID int, id string) error {
+	result, err := d.store.ExecContext(ctx, "delete from api_keys where id = $1 and user_id = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("error from postgres. can't revoke api key - %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error from postgres. can't revoke api key - %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// scanAPIKey читает ключ из строки результата. Области действия хранятся через запятую.
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (APIKey, error) {
+	var key APIKey
+	var scopes string
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Hash, &scopes, &key.CreatedAt); err != nil {
+		return key, err
+	}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	return key, nil
+}
@@ -1,63 +1,119 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"time"
 
+	"github.com/AlexCorn999/short-url-service/migrations"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/pressly/goose/v3"
 )
 
 var (
-	IDStorage    = 1
 	ErrConfilict = errors.New("URL already exists in the database")
 	ErrDeleted   = errors.New("has been deleted")
+	ErrNotFound  = errors.New("url not found")
+	ErrExpired   = errors.New("has expired")
+	ErrClosed    = errors.New("storage is closed")
 )
 
+// DuplicateCodeError возвращается, когда короткий код уже занят.
+type DuplicateCodeError struct {
+	Code string
+}
+
+func (e *DuplicateCodeError) Error() string {
+	return fmt.Sprintf("code %s is already taken", e.Code)
+}
+
+// Failed сообщает, что err — сбой хранилища, а не ожидаемый исход операции:
+// ненайденная, удалённая, просроченная или уже сокращённая ссылка, занятый код.
+func Failed(err error) bool {
+	if err == nil {
+		return false
+	}
+	var duplicate *DuplicateCodeError
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrConfilict),
+		errors.Is(err, ErrDeleted), errors.Is(err, ErrExpired),
+		errors.As(err, &duplicate):
+		return false
+	}
+	return true
+}
+
 // Task структура хадач для удаления.
 type Task struct {
-	Link    string
+	Code    string
 	Creator int
 }
 
-func NewTask(link string, creator int) *Task {
+func NewTask(code string, creator int) *Task {
 	return &Task{
-		Link:    link,
+		Code:    code,
 		Creator: creator,
 	}
 }
 
 // URL структура для использования в хранилище.
+// Хранится только код, сокращённая ссылка собирается из базового адреса при выдаче.
 type URL struct {
-	ShortURL    string `json:"short_url"`
+	Code        string `json:"code"`
 	OriginalURL string `json:"original_url"`
 	Creator     int
 	DeletedFlag bool
+	ExpiresAt   time.Time `json:"expires_at,omitempty"`
 }
 
 // NewURL возвращает новый url.
-func NewURL(short, original string, creator int) *URL {
+func NewURL(code, original string, creator int) *URL {
 	return &URL{
-		ShortURL:    short,
+		Code:        code,
 		OriginalURL: original,
 		Creator:     creator,
 		DeletedFlag: false,
 	}
 }
 
+// Expired проверяет, истёк ли срок жизни url к моменту now.
+func (u *URL) Expired(now time.Time) bool {
+	return !u.ExpiresAt.IsZero() && !now.Before(u.ExpiresAt)
+}
+
+// UserIDAllocator выдаёт идентификаторы новым пользователям.
+// Идентификаторы уникальны для одновременных вызовов и не повторяются после перезапуска.
+type UserIDAllocator interface {
+	NextUserID(ctx context.Context) (int, error)
+}
+
+// CodeCounter выдаёт номера для генерации коротких кодов.
+// Номера уникальны для одновременных вызовов, в том числе из разных экземпляров
+// сервиса с общим хранилищем, и не повторяются после перезапуска.
+type CodeCounter interface {
+	NextCodeNumber(ctx context.Context) (uint64, error)
+}
+
 // Database общая реализация базы данных.
+// Все операции, кроме Close, прерываются при отмене ctx и возвращают ошибку,
+// для которой errors.Is(err, ctx.Err()) истинно.
 type Database interface {
-	WriteURL(url *URL, id int, ssh *string) error
-	RewriteURL(url *URL) error
-	ReadURL(url *URL, ssh string) error
-	GetAllURL(id int) ([]URL, error)
-	Conflict(url *URL) (string, error)
-	DeleteURL(tasks []Task) error
+	// WriteURL сохраняет url под кодом url.Code. Если исходный url уже сокращён,
+	// в url.Code записывается существующий код и возвращается ErrConfilict.
+	WriteURL(ctx context.Context, url *URL) error
+	ReadURL(ctx context.Context, url *URL, ssh string) error
+	GetAllURL(ctx context.Context, id int) ([]URL, error)
+	Conflict(ctx context.Context, url *URL) (string, error)
+	DeleteURL(ctx context.Context, tasks []Task) error
 	Close() error
-	InitID() (int, error)
-	CheckPing() error
+	UserIDAllocator
+	CodeCounter
+	CheckPing(ctx context.Context) error
+	DeleteExpiredURL(ctx context.Context, now time.Time) (int, error)
 }
 
 // Postgres реализует хранение в postgres.
@@ -65,24 +121,17 @@ type Postgres struct {
 	store *sql.DB
 }
 
-func NextID(id *int) {
-	*id++
-}
-
-func BackID(id *int) {
-	*id--
-}
-
-// NewPostgres открывает подключение к базе данных.
+// NewPostgres открывает подключение к базе данных и применяет миграции.
 func NewPostgres(addr string) (*Postgres, error) {
 	db, err := goose.OpenDBWithDriver("pgx", addr)
 	if err != nil {
-		log.Fatalf("goose: failed to open DB: %v\n", err)
+		return nil, fmt.Errorf("goose: failed to open DB: %w", err)
 	}
 
-	err = goose.Up(db, "./migrations")
-	if err != nil {
-		log.Fatalf(err.Error())
+	goose.SetBaseFS(migrations.FS)
+	if err := goose.Up(db, "."); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("goose: failed to migrate DB: %w", err)
 	}
 
 	return &Postgres{
@@ -95,154 +144,165 @@ func (d *Postgres) Close() error {
 	return d.store.Close()
 }
 
-// WriteURL добавляет URL в базу данных.
-func (d *Postgres) WriteURL(url *URL, id int, ssh *string) error {
-
-	result, err := d.store.Exec("insert into url (shorturl, originalurl, user_id, deleted_flag) values ($1, $2, $3, $4) on conflict (shorturl) do nothing", url.OriginalURL, url.ShortURL, url.Creator, url.DeletedFlag)
-	if err != nil {
-		return fmt.Errorf("error from postgres. can't add url to db - %s", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("error from postgres. can't add url to db - %s", err)
-	}
-
-	if rowsAffected == 0 {
-		return ErrConfilict
+// WriteURL добавляет URL в базу данных за один запрос.
+// При конфликте по исходному url запрос возвращает код существующей записи.
+// Если срок существующей записи истёк, она помечается удалённой
+// и вставка повторяется.
+func (d *Postgres) WriteURL(ctx context.Context, url *URL) error {
+	var expiresAt sql.NullTime
+	if !url.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: url.ExpiresAt, Valid: true}
 	}
 
-	err = d.store.QueryRow("SELECT id FROM url WHERE shorturl = $1", url.OriginalURL).Scan(ssh)
-	if err != nil {
-		return fmt.Errorf("error from postgres. can't add url to db - %s", err)
-	}
-
-	return nil
-}
+	for {
+		// xmax = 0 только у строки, вставленной этим запросом
+		var code string
+		var inserted bool
+		var existingExpiresAt sql.NullTime
+		err := d.store.QueryRowContext(ctx, `insert into url (code, original_url, user_id, deleted_flag, expires_at) values ($1, $2, $3, $4, $5)
+			on conflict (original_url) where not deleted_flag do update set original_url = excluded.original_url
+			returning code, (xmax = 0) as inserted, expires_at`,
+			url.Code, url.OriginalURL, url.Creator, url.DeletedFlag, expiresAt).Scan(&code, &inserted, &existingExpiresAt)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation && pgErr.ConstraintName == "url_code_key" {
+				return &DuplicateCodeError{Code: url.Code}
+			}
+			return fmt.Errorf("error from postgres. can't add url to db - %w", err)
+		}
 
-// RewriteURL добавляет URL в базу данных.
-func (d *Postgres) RewriteURL(url *URL) error {
-	result, err := d.store.Exec("update url SET shorturl = $1, originalurl = $2 WHERE shorturl = $1", url.OriginalURL, url.ShortURL)
-	if err != nil {
-		return fmt.Errorf("error from postgres. can't update url in db - %s", err)
-	}
+		if inserted {
+			return nil
+		}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("error from postgres. can't update url in db - %s", err)
-	}
+		existing := URL{Code: code, ExpiresAt: existingExpiresAt.Time}
+		if !existing.Expired(time.Now()) {
+			url.Code = code
+			return ErrConfilict
+		}
 
-	if rowsAffected == 0 {
-		return ErrConfilict
+		if _, err := d.store.ExecContext(ctx, "update url set deleted_flag = true where code = $1", code); err != nil {
+			return fmt.Errorf("error from postgres. can't delete expired url - %w", err)
+		}
 	}
-
-	return nil
 }
 
-// Conflict помогает осуществить проверку на уже созданный url.
-func (d *Postgres) Conflict(url *URL) (string, error) {
-	rows, err := d.store.Query("select originalurl from url where shorturl = $1", url.OriginalURL)
+// Conflict возвращает код, под которым уже сокращён исходный url.
+func (d *Postgres) Conflict(ctx context.Context, url *URL) (string, error) {
+	var code string
+	err := d.store.QueryRowContext(ctx, "select code from url where original_url = $1 and not deleted_flag", url.OriginalURL).Scan(&code)
 	if err != nil {
-		return "", fmt.Errorf("error from postgres. %s", err)
-	}
-	defer rows.Close()
-
-	var result string
-	for rows.Next() {
-		if err = rows.Scan(&result); err != nil {
-			return "", fmt.Errorf("error from postgres. %s", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNotFound
 		}
-	}
-	if err = rows.Err(); err != nil {
-		return "", fmt.Errorf("error from postgres. %s", err)
+		return "", fmt.Errorf("error from postgres. %w", err)
 	}
 
-	return result, nil
+	return code, nil
 }
 
 // ReadURL возвращает адрес по ключу из БД.
-func (d *Postgres) ReadURL(url *URL, ssh string) error {
-	deletedFlag := false
-	row := d.store.QueryRow("select shorturl, deleted_flag from url where id = $1", ssh)
-
-	var link string
+func (d *Postgres) ReadURL(ctx context.Context, url *URL, ssh string) error {
+	row := d.store.QueryRowContext(ctx, "select code, original_url, user_id, deleted_flag, expires_at from url where code = $1", ssh)
 
-	if err := row.Scan(&link, &deletedFlag); err != nil {
-		return fmt.Errorf("error from postgres. can't read url from db - %s", err)
+	var expiresAt sql.NullTime
+	if err := row.Scan(&url.Code, &url.OriginalURL, &url.Creator, &url.DeletedFlag, &expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("error from postgres. can't read url from db - %w", err)
 	}
+	url.ExpiresAt = expiresAt.Time
 
-	if deletedFlag {
+	if url.DeletedFlag {
 		return ErrDeleted
 	}
 
-	if link == "" {
-		return errors.New("there was no link to the address specified")
+	if url.Expired(time.Now()) {
+		return ErrExpired
 	}
-
-	url.OriginalURL = link
 	return nil
 }
 
 // GetAllURL возвращает все сокращенные url пользователя.
-func (d *Postgres) GetAllURL(id int) ([]URL, error) {
+func (d *Postgres) GetAllURL(ctx context.Context, id int) ([]URL, error) {
 	var urls []URL
-	rows, err := d.store.Query("SELECT shorturl, originalurl FROM url WHERE user_id = $1", id)
+	rows, err := d.store.QueryContext(ctx, "SELECT code, original_url, user_id, deleted_flag, expires_at FROM url WHERE user_id = $1 ORDER BY id", id)
 	if err != nil {
-		return nil, fmt.Errorf("error from postgres. can't read url from db - %s", err)
+		return nil, fmt.Errorf("error from postgres. can't read url from db - %w", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var u URL
-		err := rows.Scan(&u.ShortURL, &u.OriginalURL)
+		var expiresAt sql.NullTime
+		err := rows.Scan(&u.Code, &u.OriginalURL, &u.Creator, &u.DeletedFlag, &expiresAt)
 		if err != nil {
-			return nil, fmt.Errorf("error from postgres. can't read url from db - %s", err)
+			return nil, fmt.Errorf("error from postgres. can't read url from db - %w", err)
 		}
+		u.ExpiresAt = expiresAt.Time
 		urls = append(urls, u)
 	}
 
 	err = rows.Err()
 	if err != nil {
-		return nil, fmt.Errorf("error from postgres. can't read url from db - %s", err)
+		return nil, fmt.Errorf("error from postgres. can't read url from db - %w", err)
 	}
 
 	return urls, nil
 }
 
 // CheckPing проверяет подключение к базе данных.
-func (d *Postgres) CheckPing() error {
-	return d.store.Ping()
+func (d *Postgres) CheckPing(ctx context.Context) error {
+	return d.store.PingContext(ctx)
 }
 
-// InitID первичная инициализация.
-func (d *Postgres) InitID() (int, error) {
-	var maxID int
-	err := d.store.QueryRow("select MAX(user_id) from url").Scan(&maxID)
+// NextUserID выдаёт идентификатор пользователя из последовательности user_id_seq.
+func (d *Postgres) NextUserID(ctx context.Context) (int, error) {
+	var id int
+	err := d.store.QueryRowContext(ctx, "select nextval('user_id_seq')").Scan(&id)
 	if err != nil {
-		maxID = 1
+		return 0, fmt.Errorf("error from postgres. can't allocate user id - %w", err)
 	}
-	return maxID, nil
+	return id, nil
+}
+
+// NextCodeNumber выдаёт номер кода из последовательности url_code_seq.
+func (d *Postgres) NextCodeNumber(ctx context.Context) (uint64, error) {
+	var n uint64
+	err := d.store.QueryRowContext(ctx, "select nextval('url_code_seq')").Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("error from postgres. can't allocate code number - %w", err)
+	}
+	return n, nil
 }
 
 // DeleteURL удаляет url у текущего пользователя.
-func (d *Postgres) DeleteURL(tasks []Task) error {
+func (d *Postgres) DeleteURL(ctx context.Context, tasks []Task) error {
 	deletedFlag := true
 
+	// чужие и несуществующие url пропускаются, как и в остальных хранилищах
 	for _, task := range tasks {
-		result, err := d.store.Exec("update url SET deleted_flag = $1 WHERE originalurl = $2 and user_id = $3", deletedFlag, task.Link, task.Creator)
+		_, err := d.store.ExecContext(ctx, "update url SET deleted_flag = $1 WHERE code = $2 and user_id = $3", deletedFlag, task.Code, task.Creator)
 		if err != nil {
-			return fmt.Errorf("error from postgres. can't delete url from db - %s", err)
+			return fmt.Errorf("error from postgres. can't delete url from db - %w", err)
 		}
+	}
 
-		rowsAffected, err := result.RowsAffected()
-		if err != nil {
-			return fmt.Errorf("error from postgres. can't delete url from db - %s", err)
-		}
+	return nil
+}
 
-		if rowsAffected == 0 {
-			return ErrConfilict
-		}
+// DeleteExpiredURL помечает удалёнными url с истёкшим сроком жизни.
+func (d *Postgres) DeleteExpiredURL(ctx context.Context, now time.Time) (int, error) {
+	result, err := d.store.ExecContext(ctx, "update url SET deleted_flag = true WHERE expires_at <= $1 and deleted_flag = false", now)
+	if err != nil {
+		return 0, fmt.Errorf("error from postgres. can't delete expired url from db - %w", err)
 	}
 
-	return nil
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error from postgres. can't delete expired url from db - %w", err)
+	}
+
+	return int(rowsAffected), nil
 }
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/ratelimit"
+)
+
+// Allow забирает токен из общей для всех экземпляров сервиса корзины key.
+// Строка корзины блокируется на время транзакции, время берётся из базы данных,
+// чтобы расхождение часов экземпляров не влияло на ограничение.
+func (d *Postgres) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Decision, error) {
+	tx, err := d.store.BeginTx(ctx, nil)
+	if err != nil {
+		return ratelimit.Decision{}, fmt.Errorf("error from postgres. can't check rate limit - %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "insert into rate_limits (key, tokens, updated_at) values ($1, $2, now()) on conflict (key) do nothing",
+		key, float64(limit.Burst))
+	if err != nil {
+		return ratelimit.Decision{}, fmt.Errorf("error from postgres. can't check rate limit - %w", err)
+	}
+
+	var bucket ratelimit.Bucket
+	var now time.Time
+	err = tx.QueryRowContext(ctx, "select tokens, updated_at, now() from rate_limits where key = $1 for update", key).
+		Scan(&bucket.Tokens, &bucket.Updated, &now)
+	if err != nil {
+		return ratelimit.Decision{}, fmt.Errorf("error from postgres. can't check rate limit - %w", err)
+	}
+
+	bucket, decision := ratelimit.Take(bucket, limit, now)
+	_, err = tx.ExecContext(ctx, "update rate_limits set tokens = $2, updated_at = $3 where key = $1", key, bucket.Tokens, bucket.Updated)
+	if err != nil {
+		return ratelimit.Decision{}, fmt.Errorf("error from postgres. can't check rate limit - %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ratelimit.Decision{}, fmt.Errorf("error from postgres. can't check rate limit - %w", err)
+	}
+	return decision, nil
+}
+
+// DeleteIdleRateLimits удаляет корзины, не менявшиеся дольше idle.
+// Если idle не меньше времени заполнения корзины, она уже полна
+// и не отличается от отсутствующей.
+func (d *Postgres) DeleteIdleRateLimits(ctx context.Context, idle time.Duration) (int, error) {
+	result, err := d.store.ExecContext(ctx, "delete from rate_limits where updated_at < now() - make_interval(secs => $1)", idle.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("error from postgres. can't delete rate limits - %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error from postgres. can't delete rate limits - %w", err)
+	}
+	return int(deleted), nil
+}
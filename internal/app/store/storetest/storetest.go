@@ -0,0 +1,439 @@
+// Package storetest содержит общий набор тестов на соответствие
+// поведению store.Database для всех реализаций хранилища.
+package storetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory создаёт пустое хранилище для одного теста.
+type Factory func(t *testing.T) store.Database
+
+// Run запускает набор тестов для хранилища, создаваемого newDB.
+func Run(t *testing.T, newDB Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, db store.Database)
+	}{
+		{"WriteRead", testWriteRead},
+		{"ReadNotFound", testReadNotFound},
+		{"Conflict", testConflict},
+		{"ConflictDuplicateCode", testConflictDuplicateCode},
+		{"GetAllURL", testGetAllURL},
+		{"DeleteURL", testDeleteURL},
+		{"Expired", testExpired},
+		{"Reshorten", testReshorten},
+		{"NextUserID", testNextUserID},
+		{"NextCodeNumber", testNextCodeNumber},
+		{"Accounts", testAccounts},
+		{"ClaimURLs", testClaimURLs},
+		{"APIKeys", testAPIKeys},
+		{"Canceled", testCanceled},
+		{"PingClose", testPingClose},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) { tc.test(t, newDB(t)) })
+	}
+}
+
+// write сохраняет url под кодом и проверяет, что код не изменился.
+func write(t *testing.T, db store.Database, code, original string, creator int) *store.URL {
+	t.Helper()
+	ctx := context.Background()
+
+	url := store.NewURL(code, original, creator)
+	require.NoError(t, db.WriteURL(ctx, url))
+	require.Equal(t, code, url.Code)
+	return url
+}
+
+// testWriteRead проверяет, что записанный url читается без изменений.
+func testWriteRead(t *testing.T, db store.Database) {
+	ctx := context.Background()
+
+	write(t, db, "abc", "http://practicum.ru", 3)
+
+	var url store.URL
+	require.NoError(t, db.ReadURL(ctx, &url, "abc"))
+	assert.Equal(t, "http://practicum.ru", url.OriginalURL)
+	assert.Equal(t, "abc", url.Code)
+	assert.Equal(t, 3, url.Creator)
+	assert.False(t, url.DeletedFlag)
+}
+
+func testReadNotFound(t *testing.T, db store.Database) {
+	ctx := context.Background()
+
+	var url store.URL
+	assert.ErrorIs(t, db.ReadURL(ctx, &url, "missing"), store.ErrNotFound)
+}
+
+// testConflict проверяет, что повторное сокращение исходного url
+// возвращает store.ErrConfilict и существующий код.
+func testConflict(t *testing.T, db store.Database) {
+	ctx := context.Background()
+
+	write(t, db, "first", "http://practicum.ru", 1)
+
+	second := store.NewURL("second", "http://practicum.ru", 2)
+	err := db.WriteURL(ctx, second)
+	require.ErrorIs(t, err, store.ErrConfilict)
+	assert.Equal(t, "first", second.Code)
+
+	code, err := db.Conflict(ctx, store.NewURL("", "http://practicum.ru", 2))
+	require.NoError(t, err)
+	assert.Equal(t, "first", code)
+
+	_, err = db.Conflict(ctx, store.NewURL("", "http://unknown.ru", 2))
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	// повторная запись не создаёт второй код
+	var url store.URL
+	assert.ErrorIs(t, db.ReadURL(ctx, &url, "second"), store.ErrNotFound)
+}
+
+// testConflictDuplicateCode проверяет, что занятый код отклоняется,
+// а конфликт по исходному url имеет приоритет.
+func testConflictDuplicateCode(t *testing.T, db store.Database) {
+	ctx := context.Background()
+
+	write(t, db, "code", "http://practicum.ru", 1)
+
+	err := db.WriteURL(ctx, store.NewURL("code", "http://skillbox.ru", 1))
+	var duplicateErr *store.DuplicateCodeError
+	require.ErrorAs(t, err, &duplicateErr)
+	assert.Equal(t, "code", duplicateErr.Code)
+
+	err = db.WriteURL(ctx, store.NewURL("code", "http://practicum.ru", 1))
+	assert.ErrorIs(t, err, store.ErrConfilict)
+}
+
+// testGetAllURL проверяет, что пользователь получает только свои url.
+func testGetAllURL(t *testing.T, db store.Database) {
+	ctx := context.Background()
+
+	write(t, db, "a", "http://one.ru", 1)
+	write(t, db, "b", "http://two.ru", 1)
+	write(t, db, "c", "http://three.ru", 2)
+
+	urls, err := db.GetAllURL(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, urls, 2)
+
+	originals := map[string]string{}
+	for _, url := range urls {
+		assert.Equal(t, 1, url.Creator)
+		originals[url.Code] = url.OriginalURL
+	}
+	assert.Equal(t, map[string]string{
+		"a": "http://one.ru",
+		"b": "http://two.ru",
+	}, originals)
+
+	urls, err = db.GetAllURL(ctx, 42)
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+}
+
+// testDeleteURL проверяет, что удалить url может только его создатель.
+func testDeleteURL(t *testing.T, db store.Database) {
+	ctx := context.Background()
+
+	own := write(t, db, "own", "http://one.ru", 1)
+	foreign := write(t, db, "foreign", "http://two.ru", 2)
+
+	require.NoError(t, db.DeleteURL(ctx, []store.Task{
+		*store.NewTask(own.Code, 1),
+		*store.NewTask(foreign.Code, 1),
+		*store.NewTask("missing", 1),
+	}))
+
+	var url store.URL
+	assert.ErrorIs(t, db.ReadURL(ctx, &url, "own"), store.ErrDeleted)
+	assert.NoError(t, db.ReadURL(ctx, &url, "foreign"))
+
+	urls, err := db.GetAllURL(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.True(t, urls[0].DeletedFlag)
+}
+
+// testExpired проверяет чтение и очистку url с истёкшим сроком.
+func testExpired(t *testing.T, db store.Database) {
+	ctx := context.Background()
+
+	now := time.Now()
+
+	expired := store.NewURL("old", "http://old.ru", 1)
+	expired.ExpiresAt = now.Add(-time.Minute)
+	require.NoError(t, db.WriteURL(ctx, expired))
+
+	active := store.NewURL("new", "http://new.ru", 1)
+	active.ExpiresAt = now.Add(time.Hour)
+	require.NoError(t, db.WriteURL(ctx, active))
+
+	var url store.URL
+	assert.ErrorIs(t, db.ReadURL(ctx, &url, "old"), store.ErrExpired)
+	assert.NoError(t, db.ReadURL(ctx, &url, "new"))
+
+	deleted, err := db.DeleteExpiredURL(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.ErrorIs(t, db.ReadURL(ctx, &url, "old"), store.ErrDeleted)
+
+	deleted, err = db.DeleteExpiredURL(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+}
+
+// testReshorten проверяет, что удалённый или истёкший url можно сократить заново.
+func testReshorten(t *testing.T, db store.Database) {
+	ctx := context.Background()
+
+	own := write(t, db, "old", "http://one.ru", 1)
+	require.NoError(t, db.DeleteURL(ctx, []store.Task{*store.NewTask(own.Code, 1)}))
+
+	write(t, db, "new", "http://one.ru", 1)
+
+	var url store.URL
+	assert.ErrorIs(t, db.ReadURL(ctx, &url, "old"), store.ErrDeleted)
+	require.NoError(t, db.ReadURL(ctx, &url, "new"))
+	assert.Equal(t, "http://one.ru", url.OriginalURL)
+
+	code, err := db.Conflict(ctx, store.NewURL("", "http://one.ru", 1))
+	require.NoError(t, err)
+	assert.Equal(t, "new", code)
+
+	expired := store.NewURL("stale", "http://two.ru", 1)
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	require.NoError(t, db.WriteURL(ctx, expired))
+
+	write(t, db, "fresh", "http://two.ru", 1)
+	assert.ErrorIs(t, db.ReadURL(ctx, &url, "stale"), store.ErrDeleted)
+	assert.NoError(t, db.ReadURL(ctx, &url, "fresh"))
+}
+
+// testNextUserID проверяет, что одновременно выданные идентификаторы уникальны и положительны.
+func testNextUserID(t *testing.T, db store.Database) {
+	const workers = 8
+	const perWorker = 25
+
+	ids := make(chan int, workers*perWorker)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				id, err := db.NextUserID(context.Background())
+				assert.NoError(t, err)
+				ids <- id
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int]struct{})
+	for id := range ids {
+		assert.Positive(t, id)
+		assert.NotContains(t, seen, id)
+		seen[id] = struct{}{}
+	}
+	assert.Len(t, seen, workers*perWorker)
+}
+
+// testNextCodeNumber проверяет, что одновременно выданные номера кодов уникальны и положительны.
+func testNextCodeNumber(t *testing.T, db store.Database) {
+	const workers = 8
+	const perWorker = 25
+
+	numbers := make(chan uint64, workers*perWorker)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				n, err := db.NextCodeNumber(context.Background())
+				assert.NoError(t, err)
+				numbers <- n
+			}
+		}()
+	}
+	wg.Wait()
+	close(numbers)
+
+	seen := make(map[uint64]struct{})
+	for n := range numbers {
+		assert.Positive(t, n)
+		assert.NotContains(t, seen, n)
+		seen[n] = struct{}{}
+	}
+	assert.Len(t, seen, workers*perWorker)
+}
+
+// accounts возвращает хранилище пользователей. Его реализуют все хранилища.
+func accounts(t *testing.T, db store.Database) store.Accounts {
+	t.Helper()
+
+	accounts, ok := db.(store.Accounts)
+	require.True(t, ok, "%T does not implement store.Accounts", db)
+	return accounts
+}
+
+// testAccounts проверяет создание пользователя и поиск по логину.
+func testAccounts(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	users := accounts(t, db)
+
+	_, err := users.UserByLogin(ctx, "alice")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	user := &store.User{ID: 5, Login: "alice", PasswordHash: []byte("hash")}
+	require.NoError(t, users.CreateUser(ctx, user))
+
+	got, err := users.UserByLogin(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, *user, got)
+
+	err = users.CreateUser(ctx, &store.User{ID: 6, Login: "alice", PasswordHash: []byte("other")})
+	assert.ErrorIs(t, err, store.ErrUserExists)
+}
+
+// testClaimURLs проверяет передачу ссылок анонимного пользователя
+// и запрет на передачу ссылок зарегистрированного.
+func testClaimURLs(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	users := accounts(t, db)
+
+	write(t, db, "a", "http://one.ru", 1)
+	write(t, db, "b", "http://two.ru", 1)
+	write(t, db, "c", "http://three.ru", 2)
+	require.NoError(t, users.CreateUser(ctx, &store.User{ID: 2, Login: "bob", PasswordHash: []byte("hash")}))
+
+	claimed, err := users.ClaimURLs(ctx, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, claimed)
+
+	urls, err := db.GetAllURL(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+
+	urls, err = db.GetAllURL(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, urls, 3)
+	for _, url := range urls {
+		assert.Equal(t, 2, url.Creator)
+	}
+
+	// ссылки зарегистрированного пользователя остаются у него
+	claimed, err = users.ClaimURLs(ctx, 2, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 0, claimed)
+
+	// новый владелец может удалять полученные ссылки
+	require.NoError(t, db.DeleteURL(ctx, []store.Task{*store.NewTask("a", 2)}))
+	var url store.URL
+	assert.ErrorIs(t, db.ReadURL(ctx, &url, "a"), store.ErrDeleted)
+}
+
+// testAPIKeys проверяет создание, поиск, список и отзыв API ключей.
+func testAPIKeys(t *testing.T, db store.Database) {
+	ctx := context.Background()
+
+	keys, ok := db.(store.APIKeys)
+	require.True(t, ok, "%T does not implement store.APIKeys", db)
+
+	created := time.Now().UTC().Truncate(time.Second)
+	first := &store.APIKey{ID: "k1", UserID: 1, Name: "ci", Hash: "h1", Scopes: []string{"read"}, CreatedAt: created}
+	second := &store.APIKey{ID: "k2", UserID: 1, Name: "", Hash: "h2", Scopes: []string{"read", "shorten"}, CreatedAt: created.Add(time.Second)}
+	foreign := &store.APIKey{ID: "k3", UserID: 2, Name: "other", Hash: "h3", Scopes: []string{"delete"}, CreatedAt: created}
+	for _, key := range []*store.APIKey{second, first, foreign} {
+		require.NoError(t, keys.CreateAPIKey(ctx, key))
+	}
+
+	got, err := keys.APIKeyByHash(ctx, "h2")
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, got.ID)
+	assert.Equal(t, second.UserID, got.UserID)
+	assert.Equal(t, second.Scopes, got.Scopes)
+	assert.True(t, second.CreatedAt.Equal(got.CreatedAt))
+
+	_, err = keys.APIKeyByHash(ctx, "missing")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	list, err := keys.ListAPIKeys(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "k1", list[0].ID)
+	assert.Equal(t, "k2", list[1].ID)
+
+	// чужой ключ отозвать нельзя
+	assert.ErrorIs(t, keys.RevokeAPIKey(ctx, 1, "k3"), store.ErrNotFound)
+	require.NoError(t, keys.RevokeAPIKey(ctx, 1, "k1"))
+	assert.ErrorIs(t, keys.RevokeAPIKey(ctx, 1, "k1"), store.ErrNotFound)
+
+	_, err = keys.APIKeyByHash(ctx, "h1")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	_, err = keys.APIKeyByHash(ctx, "h3")
+	assert.NoError(t, err)
+}
+
+// testCanceled проверяет, что операции с отменённым контекстом возвращают его ошибку
+// и не изменяют данные.
+func testCanceled(t *testing.T, db store.Database) {
+	write(t, db, "a", "http://one.ru", 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var url store.URL
+	assert.ErrorIs(t, db.WriteURL(ctx, store.NewURL("b", "http://two.ru", 1)), context.Canceled)
+	assert.ErrorIs(t, db.ReadURL(ctx, &url, "a"), context.Canceled)
+	_, err := db.GetAllURL(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = db.Conflict(ctx, store.NewURL("", "http://one.ru", 1))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, db.DeleteURL(ctx, []store.Task{*store.NewTask("a", 1)}), context.Canceled)
+	_, err = db.NextUserID(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = db.DeleteExpiredURL(ctx, time.Now())
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, db.CheckPing(ctx), context.Canceled)
+	users := accounts(t, db)
+	assert.ErrorIs(t, users.CreateUser(ctx, &store.User{ID: 1, Login: "alice"}), context.Canceled)
+	_, err = users.UserByLogin(ctx, "alice")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = users.ClaimURLs(ctx, 1, 2)
+	assert.ErrorIs(t, err, context.Canceled)
+	keys := db.(store.APIKeys)
+	assert.ErrorIs(t, keys.CreateAPIKey(ctx, &store.APIKey{ID: "k1", UserID: 1, Hash: "h1"}), context.Canceled)
+	_, err = keys.APIKeyByHash(ctx, "h1")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = keys.ListAPIKeys(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, keys.RevokeAPIKey(ctx, 1, "k1"), context.Canceled)
+
+	ctx = context.Background()
+	assert.NoError(t, db.ReadURL(ctx, &url, "a"))
+	assert.ErrorIs(t, db.ReadURL(ctx, &url, "b"), store.ErrNotFound)
+}
+
+// testPingClose проверяет, что после закрытия хранилище недоступно.
+func testPingClose(t *testing.T, db store.Database) {
+	ctx := context.Background()
+
+	require.NoError(t, db.CheckPing(ctx))
+	require.NoError(t, db.Close())
+	assert.Error(t, db.CheckPing(ctx))
+}
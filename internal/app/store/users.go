@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var ErrUserExists = errors.New("user already exists")
+
+// User зарегистрированный пользователь.
+type User struct {
+	ID           int    `json:"id"`
+	Login        string `json:"login"`
+	PasswordHash []byte `json:"password_hash"`
+}
+
+// Accounts общая реализация хранилища зарегистрированных пользователей.
+type Accounts interface {
+	// CreateUser сохраняет пользователя. Если логин занят, возвращается ErrUserExists.
+	CreateUser(ctx context.Context, user *User) error
+	// UserByLogin возвращает пользователя по логину или ErrNotFound.
+	UserByLogin(ctx context.Context, login string) (User, error)
+	// ClaimURLs передаёт ссылки анонимного пользователя from пользователю to
+	// и возвращает их количество. Ссылки зарегистрированного пользователя не передаются.
+	ClaimURLs(ctx context.Context, from, to int) (int, error)
+}
+
+// CreateUser сохраняет пользователя в базу данных.
+func (d *Postgres) CreateUser(ctx context.Context, user *User) error {
+	_, err := d.store.ExecContext(ctx, "insert into users (id, login, password_hash) values ($1, $2, $3)",
+		user.ID, user.Login, user.PasswordHash)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation && pgErr.ConstraintName == "users_login_key" {
+			return ErrUserExists
+		}
+		return fmt.Errorf("error from postgres. can't add user to db - %w", err)
+	}
+	return nil
+}
+
+// UserByLogin возвращает пользователя по логину.
+func (d *Postgres) UserByLogin(ctx context.Context, login string) (User, error) {
+	var user User
+	err := d.store.QueryRowContext(ctx, "select id, login, password_hash from users where login = $1", login).
+		Scan(&user.ID, &user.Login, &user.PasswordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, ErrNotFound
+		}
+		return user, fmt.Errorf("error from postgres. can't read user from db - %w", err)
+	}
+	return user, nil
+}
+
+// ClaimURLs передаёт ссылки анонимного пользователя зарегистрированному.
+func (d *Postgres) ClaimURLs(ctx context.Context, from, to int) (int, error) {
+	result, err := d.store.ExecContext(ctx, `update url set user_id = $2 where user_id = $1
+		and $1 <> $2 and not exists (select 1 from users where id = $1)`, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("error from postgres. can't claim urls - %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error from postgres. can't claim urls - %w", err)
+	}
+	return int(rowsAffected), nil
+}
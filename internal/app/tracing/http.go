@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/logger"
+	"github.com/go-chi/chi"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware начинает серверный спан запроса, продолжая трассу из заголовка traceparent.
+// Имя спана содержит шаблон маршрута chi, известный после обработки запроса.
+// Без провайдера запросы не трассируются.
+func Middleware(tp trace.TracerProvider) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if tp == nil {
+			return next
+		}
+		tracer := tp.Tracer(instrumentationName)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, "HTTP "+r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.method", r.Method),
+					attribute.String("http.target", r.URL.Path),
+				))
+			defer span.End()
+
+			sw := &logger.LoggingResponseWriter{ResponseWriter: w, ResponseData: &logger.ResponseData{}}
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			status := sw.ResponseData.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttributes(attribute.Int("http.status_code", status))
+			if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+				span.SetName(r.Method + " " + rctx.RoutePattern())
+				span.SetAttributes(attribute.String("http.route", rctx.RoutePattern()))
+			}
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, strconv.Itoa(status)+" "+http.StatusText(status))
+			}
+		})
+	}
+}
+
+// Span оборачивает middleware mw спаном name. Спан охватывает mw
+// и следующие за ним обработчики, их спаны вложены в него.
+// Без провайдера mw возвращается как есть.
+func Span(tp trace.TracerProvider, name string, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	if tp == nil {
+		return mw
+	}
+	tracer := tp.Tracer(instrumentationName)
+	return func(next http.Handler) http.Handler {
+		inner := mw(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := tracer.Start(r.Context(), name)
+			defer span.End()
+			inner.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Database оборачивает store.Database и создаёт спан на каждую операцию.
+// Ожидаемые исходы вроде ненайденной или уже сокращённой ссылки ошибками не отмечаются.
+type Database struct {
+	store.Database
+	tracer  trace.Tracer
+	backend string
+}
+
+// WrapDatabase возвращает db со спанами для хранилища backend.
+// Без провайдера db возвращается как есть.
+func WrapDatabase(db store.Database, backend string, tp trace.TracerProvider) store.Database {
+	if tp == nil {
+		return db
+	}
+	return &Database{Database: db, tracer: tp.Tracer(instrumentationName), backend: backend}
+}
+
+// Unwrap возвращает исходное хранилище.
+func (d *Database) Unwrap() store.Database {
+	return d.Database
+}
+
+// start начинает спан операции.
+func (d *Database) start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("db.system", d.backend), attribute.String("db.operation", operation))
+	return d.tracer.Start(ctx, "store."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+}
+
+// end завершает спан операции с результатом err.
+func end(span trace.Span, err error) {
+	if store.Failed(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if err != nil {
+		span.SetAttributes(attribute.String("db.result", err.Error()))
+	}
+	span.End()
+}
+
+func (d *Database) WriteURL(ctx context.Context, url *store.URL) error {
+	ctx, span := d.start(ctx, "WriteURL", attribute.String("url.code", url.Code))
+	err := d.Database.WriteURL(ctx, url)
+	end(span, err)
+	return err
+}
+
+func (d *Database) ReadURL(ctx context.Context, url *store.URL, code string) error {
+	ctx, span := d.start(ctx, "ReadURL", attribute.String("url.code", code))
+	err := d.Database.ReadURL(ctx, url, code)
+	end(span, err)
+	return err
+}
+
+func (d *Database) GetAllURL(ctx context.Context, id int) ([]store.URL, error) {
+	ctx, span := d.start(ctx, "GetAllURL", attribute.Int("user.id", id))
+	urls, err := d.Database.GetAllURL(ctx, id)
+	end(span, err)
+	return urls, err
+}
+
+func (d *Database) Conflict(ctx context.Context, url *store.URL) (string, error) {
+	ctx, span := d.start(ctx, "Conflict")
+	code, err := d.Database.Conflict(ctx, url)
+	end(span, err)
+	return code, err
+}
+
+func (d *Database) DeleteURL(ctx context.Context, tasks []store.Task) error {
+	ctx, span := d.start(ctx, "DeleteURL", attribute.Int("tasks", len(tasks)))
+	err := d.Database.DeleteURL(ctx, tasks)
+	end(span, err)
+	return err
+}
+
+func (d *Database) NextUserID(ctx context.Context) (int, error) {
+	ctx, span := d.start(ctx, "NextUserID")
+	id, err := d.Database.NextUserID(ctx)
+	end(span, err)
+	return id, err
+}
+
+func (d *Database) NextCodeNumber(ctx context.Context) (uint64, error) {
+	ctx, span := d.start(ctx, "NextCodeNumber")
+	n, err := d.Database.NextCodeNumber(ctx)
+	end(span, err)
+	return n, err
+}
+
+func (d *Database) CheckPing(ctx context.Context) error {
+	ctx, span := d.start(ctx, "CheckPing")
+	err := d.Database.CheckPing(ctx)
+	end(span, err)
+	return err
+}
+
+func (d *Database) DeleteExpiredURL(ctx context.Context, now time.Time) (int, error) {
+	ctx, span := d.start(ctx, "DeleteExpiredURL")
+	n, err := d.Database.DeleteExpiredURL(ctx, now)
+	end(span, err)
+	return n, err
+}
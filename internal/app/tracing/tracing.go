@@ -0,0 +1,84 @@
+// Package tracing собирает трассировку запросов OpenTelemetry:
+// от цепочки middleware через обработчики до вызовов хранилища.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Экспортёры спанов.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// имя инструментирования в спанах
+const instrumentationName = "github.com/AlexCorn999/short-url-service"
+
+// propagator передаёт контекст трассировки в заголовке traceparent по W3C Trace Context.
+var propagator = propagation.TraceContext{}
+
+// Options настройки трассировки.
+type Options struct {
+	// none, stdout или otlp
+	Exporter string
+	// адрес коллектора OTLP/HTTP, например http://localhost:4318/v1/traces
+	Endpoint    string
+	ServiceName string
+	// доля записываемых трасс от 0 до 1, входящий traceparent решает за неё
+	SampleRatio float64
+	// вывод экспортёра stdout, по умолчанию os.Stdout
+	Writer io.Writer
+}
+
+// NewExporter возвращает экспортёр спанов. Для none возвращается nil.
+func NewExporter(opts Options) (sdktrace.SpanExporter, error) {
+	switch opts.Exporter {
+	case ExporterNone, "":
+		return nil, nil
+	case ExporterStdout:
+		w := opts.Writer
+		if w == nil {
+			w = os.Stdout
+		}
+		return stdouttrace.New(stdouttrace.WithWriter(w))
+	case ExporterOTLP:
+		if opts.Endpoint == "" {
+			return nil, fmt.Errorf("tracing exporter %s requires an endpoint", ExporterOTLP)
+		}
+		return otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(opts.Endpoint))
+	}
+	return nil, fmt.Errorf("unknown tracing exporter %q", opts.Exporter)
+}
+
+// NewProvider создаёт провайдер, который пачками отправляет спаны в exporter.
+func NewProvider(exporter sdktrace.SpanExporter, opts Options) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", opts.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+}
+
+// Setup создаёт провайдер по настройкам. Без экспортёра возвращается nil
+// и трассировка отключена. shutdown отправляет оставшиеся спаны.
+func Setup(opts Options) (provider trace.TracerProvider, shutdown func(context.Context) error, err error) {
+	exporter, err := NewExporter(opts)
+	if err != nil || exporter == nil {
+		return nil, nil, err
+	}
+	tp := NewProvider(exporter, opts)
+	return tp, tp.Shutdown, nil
+}
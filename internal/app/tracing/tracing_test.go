@@ -0,0 +1,196 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/memorystorage"
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTestProvider возвращает провайдер, синхронно записывающий спаны в память.
+func newTestProvider() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), exporter
+}
+
+// spanByName ищет спан по имени.
+func spanByName(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("span %q not found", name)
+	return tracetest.SpanStub{}
+}
+
+func TestMiddleware(t *testing.T) {
+	tp, exporter := newTestProvider()
+	db := WrapDatabase(memorystorage.NewMemoryStorage(), "local", tp)
+
+	passThrough := func(next http.Handler) http.Handler { return next }
+	router := chi.NewRouter()
+	router.Use(Middleware(tp))
+	router.Use(Span(tp, "Auth", passThrough))
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var url store.URL
+		if err := db.ReadURL(r.Context(), &url, chi.URLParam(r, "id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.Header.Set("traceparent", traceparent)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+
+	server := spanByName(t, spans, "GET /{id}")
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	// трасса продолжается из traceparent
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.Contains(t, server.Attributes, attribute.Int("http.status_code", http.StatusNotFound))
+	// 4xx не ошибка сервера
+	assert.Equal(t, codes.Unset, server.Status.Code)
+
+	auth := spanByName(t, spans, "Auth")
+	assert.Equal(t, server.SpanContext.SpanID(), auth.Parent.SpanID())
+
+	read := spanByName(t, spans, "store.ReadURL")
+	assert.Equal(t, auth.SpanContext.SpanID(), read.Parent.SpanID())
+	assert.Equal(t, trace.SpanKindClient, read.SpanKind)
+	// ненайденная ссылка не сбой хранилища
+	assert.Equal(t, codes.Unset, read.Status.Code)
+}
+
+func TestMiddlewareServerError(t *testing.T) {
+	tp, exporter := newTestProvider()
+	router := chi.NewRouter()
+	router.Use(Middleware(tp))
+	router.Post("/api/shorten", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/shorten", nil))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "POST /api/shorten", spans[0].Name)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	// новая трасса без traceparent
+	assert.False(t, spans[0].Parent.IsValid())
+}
+
+func TestDisabled(t *testing.T) {
+	db := memorystorage.NewMemoryStorage()
+	assert.Same(t, db, WrapDatabase(db, "local", nil))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	assert.NotNil(t, Middleware(nil)(handler))
+	assert.NotNil(t, Span(nil, "Auth", func(next http.Handler) http.Handler { return next })(handler))
+
+	tp, shutdown, err := Setup(Options{Exporter: ExporterNone})
+	require.NoError(t, err)
+	assert.Nil(t, tp)
+	assert.Nil(t, shutdown)
+
+	_, _, err = Setup(Options{Exporter: "jaeger"})
+	assert.Error(t, err)
+	_, _, err = Setup(Options{Exporter: ExporterOTLP})
+	assert.Error(t, err)
+}
+
+func TestStoreFailure(t *testing.T) {
+	tp, exporter := newTestProvider()
+	db := WrapDatabase(memorystorage.NewMemoryStorage(), "local", tp)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, db.WriteURL(ctx, store.NewURL("a", "http://a.ru", 1)))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "store.WriteURL", spans[0].Name)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	require.Len(t, spans[0].Events, 1)
+	assert.Equal(t, "exception", spans[0].Events[0].Name)
+}
+
+func TestStdoutExporter(t *testing.T) {
+	var out bytes.Buffer
+	tp, shutdown, err := Setup(Options{Exporter: ExporterStdout, ServiceName: "test", SampleRatio: 1, Writer: &out})
+	require.NoError(t, err)
+
+	_, span := tp.Tracer("test").Start(context.Background(), "work")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	assert.Contains(t, out.String(), `"Name":"work"`)
+	assert.Contains(t, out.String(), `"Value":"test"`)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var requests int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+	}))
+	defer collector.Close()
+
+	tp, shutdown, err := Setup(Options{Exporter: ExporterOTLP, Endpoint: collector.URL + "/v1/traces", ServiceName: "test", SampleRatio: 1})
+	require.NoError(t, err)
+
+	_, span := tp.Tracer("test").Start(context.Background(), "work")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestLogHook(t *testing.T) {
+	tp, _ := newTestProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+
+	var out bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&out)
+	logger.SetFormatter(&log.JSONFormatter{})
+	logger.AddHook(LogHook{})
+
+	logger.WithContext(ctx).Info("with span")
+	logger.Info("without span")
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(lines[0], &entry))
+	assert.Equal(t, span.SpanContext().TraceID().String(), entry["trace_id"])
+	assert.Equal(t, span.SpanContext().SpanID().String(), entry["span_id"])
+
+	entry = nil
+	require.NoError(t, json.Unmarshal(lines[1], &entry))
+	assert.NotContains(t, entry, "trace_id")
+}
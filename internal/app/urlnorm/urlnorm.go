@@ -0,0 +1,181 @@
+// Package urlnorm проверяет и нормализует исходные ссылки перед сокращением.
+package urlnorm
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Коды ошибок проверки.
+const (
+	CodeEmpty            = "empty_url"
+	CodeTooLong          = "url_too_long"
+	CodeInvalid          = "invalid_url"
+	CodeSchemeNotAllowed = "scheme_not_allowed"
+	CodeMissingHost      = "missing_host"
+	CodeInvalidHost      = "invalid_host"
+	CodeInvalidPort      = "invalid_port"
+	CodeUserinfo         = "userinfo_not_allowed"
+)
+
+// DefaultMaxLength совпадает с размером колонки original_url.
+const DefaultMaxLength = 255
+
+// DefaultSchemes разрешённые по умолчанию схемы.
+var DefaultSchemes = []string{"http", "https"}
+
+// порты по умолчанию, которые убираются из адреса
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Error ошибка проверки ссылки с машиночитаемым кодом.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Options правила проверки.
+type Options struct {
+	// разрешённые схемы, по умолчанию DefaultSchemes
+	AllowedSchemes []string
+	// схема для ссылок без схемы, пустая строка отключает подстановку
+	DefaultScheme string
+	// максимальная длина нормализованной ссылки, по умолчанию DefaultMaxLength
+	MaxLength int
+}
+
+// Normalizer проверяет и нормализует ссылки.
+type Normalizer struct {
+	schemes       map[string]struct{}
+	defaultScheme string
+	maxLength     int
+}
+
+// New возвращает Normalizer с правилами opts.
+func New(opts Options) (*Normalizer, error) {
+	schemes := opts.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+
+	n := &Normalizer{
+		schemes:       make(map[string]struct{}, len(schemes)),
+		defaultScheme: strings.ToLower(opts.DefaultScheme),
+		maxLength:     opts.MaxLength,
+	}
+	for _, scheme := range schemes {
+		n.schemes[strings.ToLower(strings.TrimSpace(scheme))] = struct{}{}
+	}
+	if n.maxLength <= 0 {
+		n.maxLength = DefaultMaxLength
+	}
+
+	if n.defaultScheme != "" {
+		if _, ok := n.schemes[n.defaultScheme]; !ok {
+			return nil, fmt.Errorf("default scheme %q is not allowed", opts.DefaultScheme)
+		}
+	}
+	return n, nil
+}
+
+// Normalize проверяет ссылку и возвращает её нормализованный вид:
+// схема и хост в нижнем регистре, IDN в punycode, без порта по умолчанию
+// и без завершающего слеша у пустого пути. Остальной путь, запрос и фрагмент
+// сохраняются без изменений. Ошибки проверки имеют тип *Error.
+func (n *Normalizer) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", newError(CodeEmpty, "url is empty")
+	}
+	// длинные строки отклоняются до разбора
+	if len(raw) > 4*n.maxLength {
+		return "", newError(CodeTooLong, "url is longer than %d characters", n.maxLength)
+	}
+
+	if !strings.Contains(raw, "://") && n.defaultScheme != "" {
+		raw = n.defaultScheme + "://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", newError(CodeInvalid, "url can't be parsed")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme == "" {
+		return "", newError(CodeInvalid, "url must have a scheme")
+	}
+	if _, ok := n.schemes[u.Scheme]; !ok {
+		return "", newError(CodeSchemeNotAllowed, "scheme %q is not allowed", u.Scheme)
+	}
+
+	// адрес вида http://user@host часто используется для маскировки настоящего хоста
+	if u.User != nil {
+		return "", newError(CodeUserinfo, "url must not contain user info")
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+
+	port := u.Port()
+	if port != "" {
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return "", newError(CodeInvalidPort, "port %q is not valid", port)
+		}
+	}
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if u.Path == "/" && u.RawQuery == "" && u.Fragment == "" {
+		u.Path = ""
+	}
+
+	result := u.String()
+	if len(result) > n.maxLength {
+		return "", newError(CodeTooLong, "url is longer than %d characters", n.maxLength)
+	}
+	return result, nil
+}
+
+// normalizeHost переводит хост в нижний регистр и IDN в punycode.
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", newError(CodeMissingHost, "url must have a host")
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+	if err != nil || ascii == "" {
+		return "", newError(CodeInvalidHost, "host %q is not valid", host)
+	}
+	return ascii, nil
+}
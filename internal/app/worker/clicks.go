@@ -0,0 +1,126 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// ClickQueue накапливает переходы и пачками сохраняет их в хранилище,
+// чтобы запись статистики не замедляла редирект.
+type ClickQueue struct {
+	ch     chan store.Click
+	store  store.Analytics
+	logger *log.Logger
+	clicks []store.Click
+	// размер пачки, при котором переходы сохраняются досрочно
+	size     int
+	done     chan struct{}
+	interval time.Duration
+}
+
+func NewClickQueue(storage store.Analytics, logger *log.Logger, size int) *ClickQueue {
+	return &ClickQueue{
+		store:    storage,
+		logger:   logger,
+		ch:       make(chan store.Click, size),
+		clicks:   make([]store.Click, 0, size),
+		size:     size,
+		done:     make(chan struct{}),
+		interval: DefaultInterval,
+	}
+}
+
+// SetInterval задаёт период сохранения накопленных переходов. Вызывается до Start.
+func (q *ClickQueue) SetInterval(interval time.Duration) {
+	q.interval = interval
+}
+
+// Start добавляет переходы в массив и сохраняет их раз в период SetInterval
+// или при заполнении массива. После отмены ctx оставшиеся переходы сохраняются,
+// и очередь завершается.
+func (q *ClickQueue) Start(ctx context.Context) {
+	ticker := time.NewTicker(q.interval)
+
+	go func() {
+		defer close(q.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case click := <-q.ch:
+				q.clicks = append(q.clicks, click)
+				if len(q.clicks) >= q.size {
+					if err := q.doWriteClicks(); err != nil {
+						q.logger.Info(err.Error())
+					}
+				}
+			case <-ctx.Done():
+				q.drain()
+				if err := q.doWriteClicks(); err != nil {
+					q.logger.Info(err.Error())
+				}
+				return
+			case <-ticker.C:
+				if err := q.doWriteClicks(); err != nil {
+					q.logger.Info(err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// Wait ждёт завершения очереди после отмены контекста Start,
+// но не дольше, чем до отмены ctx.
+func (q *ClickQueue) Wait(ctx context.Context) error {
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("click queue: %w", ctx.Err())
+	}
+}
+
+// drain забирает из канала переходы, отправленные до остановки очереди.
+func (q *ClickQueue) drain() {
+	for {
+		select {
+		case click := <-q.ch:
+			q.clicks = append(q.clicks, click)
+		default:
+			return
+		}
+	}
+}
+
+// Push отправляет переход в канал без ожидания.
+// Если очередь переполнена, переход отбрасывается.
+func (q *ClickQueue) Push(click store.Click) {
+	select {
+	case q.ch <- click:
+	default:
+		q.logger.Debug(fmt.Sprintf("click queue is full, click for %s dropped", click.Code))
+	}
+}
+
+// doWriteClicks отвечает за сохранение переходов.
+// Переходы сохраняются и после отмены контекста очереди, поэтому он не передаётся в хранилище.
+// Если сохранить не удалось, пачка отбрасывается, чтобы массив не рос,
+// пока хранилище недоступно: статистика переходов не критична.
+func (q *ClickQueue) doWriteClicks() error {
+	if len(q.clicks) == 0 {
+		return nil
+	}
+
+	if err := q.store.WriteClicks(context.Background(), q.clicks); err != nil {
+		dropped := len(q.clicks)
+		q.clicks = q.clicks[:0]
+		return fmt.Errorf("error from click queue. %d clicks dropped - %w", dropped, err)
+	}
+
+	q.logger.Debug(fmt.Sprintf("Successfully saved %d clicks", len(q.clicks)))
+	q.clicks = q.clicks[:0]
+	return nil
+}
@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// RateLimitStore хранилище корзин ограничителя частоты запросов,
+// из которого можно удалить давно не менявшиеся корзины.
+type RateLimitStore interface {
+	DeleteIdleRateLimits(ctx context.Context, idle time.Duration) (int, error)
+}
+
+// ExpiredURLReaper периодически помечает удалёнными url с истёкшим сроком жизни
+// и удаляет заполнившиеся корзины ограничителя частоты запросов.
+type ExpiredURLReaper struct {
+	store    store.Database
+	logger   *log.Logger
+	interval time.Duration
+
+	limits RateLimitStore
+	idle   time.Duration
+
+	// закрывается, когда очистка остановлена
+	done chan struct{}
+}
+
+func NewExpiredURLReaper(storage store.Database, logger *log.Logger, interval time.Duration) *ExpiredURLReaper {
+	return &ExpiredURLReaper{
+		store:    storage,
+		logger:   logger,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// SetRateLimits включает удаление корзин, не менявшихся дольше idle.
+func (r *ExpiredURLReaper) SetRateLimits(limits RateLimitStore, idle time.Duration) {
+	r.limits = limits
+	r.idle = idle
+}
+
+// Start запускает очистку через каждые interval до отмены контекста.
+func (r *ExpiredURLReaper) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+
+	go func() {
+		defer close(r.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := r.doReap(ctx); err != nil {
+					r.logger.Info(err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// Wait дожидается остановки очистки после отмены контекста Start,
+// чтобы хранилище не закрылось во время удаления.
+func (r *ExpiredURLReaper) Wait(ctx context.Context) error {
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("expired url reaper: %w", ctx.Err())
+	}
+}
+
+// doReap отвечает за удаление url с истёкшим сроком.
+func (r *ExpiredURLReaper) doReap(ctx context.Context) error {
+	deleted, err := r.store.DeleteExpiredURL(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if deleted > 0 {
+		r.logger.Info(fmt.Sprintf("Successfully reaped %d expired urls", deleted))
+	}
+
+	if r.limits == nil {
+		return nil
+	}
+	deleted, err = r.limits.DeleteIdleRateLimits(ctx, r.idle)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		r.logger.Info(fmt.Sprintf("Successfully reaped %d idle rate limits", deleted))
+	}
+	return nil
+}
@@ -9,35 +9,69 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// DeleteObserver получает сведения о работе очереди удаления, например для метрик.
+// Методы вызываются из горутины воркера.
+type DeleteObserver interface {
+	// QueueDepth сообщает число задач, ожидающих удаления.
+	QueueDepth(n int)
+	// DeleteBatch сообщает размер удалённой пачки и ошибку удаления.
+	DeleteBatch(size int, err error)
+}
+
+// DefaultInterval период сохранения накопленных в очередях задач.
+const DefaultInterval = 5 * time.Second
+
 type DeleteURLQueue struct {
-	ch     chan *store.Task
-	store  store.Database
-	logger *log.Logger
-	tasks  []store.Task
+	ch       chan *store.Task
+	store    store.Database
+	logger   *log.Logger
+	tasks    []store.Task
+	done     chan struct{}
+	observer DeleteObserver
+	interval time.Duration
 }
 
 func NewDeleteURLQueue(storage store.Database, logger *log.Logger, maxWorker int) *DeleteURLQueue {
 	return &DeleteURLQueue{
-		store:  storage,
-		logger: logger,
-		ch:     make(chan *store.Task, maxWorker),
-		tasks:  make([]store.Task, 0, 500),
+		store:    storage,
+		logger:   logger,
+		ch:       make(chan *store.Task, maxWorker),
+		tasks:    make([]store.Task, 0, 500),
+		done:     make(chan struct{}),
+		interval: DefaultInterval,
 	}
 }
 
-// Start добавляет задачи в массив и запускаети удаление задач через каждые 10 секунд.
+// SetInterval задаёт период удаления накопленных задач. Вызывается до Start.
+func (q *DeleteURLQueue) SetInterval(interval time.Duration) {
+	q.interval = interval
+}
+
+// SetObserver задаёт наблюдателя очереди. Вызывается до Start.
+func (q *DeleteURLQueue) SetObserver(observer DeleteObserver) {
+	q.observer = observer
+}
+
+// Start добавляет задачи в массив и запускаети удаление задач раз в период SetInterval, по умолчанию 5 секунд.
+// После отмены ctx оставшиеся задачи удаляются, и воркер завершается.
+// Push после отмены ctx вызывать нельзя.
 func (q *DeleteURLQueue) Start(ctx context.Context) {
-	ticker := time.NewTicker(time.Second * 5)
+	ticker := time.NewTicker(q.interval)
 
 	go func() {
+		defer close(q.done)
+		defer ticker.Stop()
 		for {
 			select {
 			case task := <-q.ch:
 				q.tasks = append(q.tasks, *task)
+				q.observeDepth()
 			case <-ctx.Done():
+				q.drain()
 				if err := q.doDeleteTasks(); err != nil {
 					q.logger.Info(err.Error())
 				}
+				return
 			case <-ticker.C:
 				if err := q.doDeleteTasks(); err != nil {
 					q.logger.Info(err.Error())
@@ -47,23 +81,58 @@ func (q *DeleteURLQueue) Start(ctx context.Context) {
 	}()
 }
 
+// Wait ждёт завершения воркера после отмены контекста Start,
+// но не дольше, чем до отмены ctx.
+func (q *DeleteURLQueue) Wait(ctx context.Context) error {
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("delete queue: %w", ctx.Err())
+	}
+}
+
 // Push отправляет url в канал для дальнейшего удаления.
 func (q *DeleteURLQueue) Push(task *store.Task) {
 	q.ch <- task
 }
 
+// drain забирает из канала задачи, отправленные до остановки воркера.
+func (q *DeleteURLQueue) drain() {
+	for {
+		select {
+		case task := <-q.ch:
+			q.tasks = append(q.tasks, *task)
+		default:
+			return
+		}
+	}
+}
+
 // doDeleteTasks отвечает за удаления url.
+// Задачи удаляются и после отмены контекста воркера, поэтому он не передаётся в хранилище.
 func (q *DeleteURLQueue) doDeleteTasks() error {
 	if len(q.tasks) == 0 {
 		return nil
 	}
 
-	if err := q.store.DeleteURL(q.tasks); err != nil {
-		fmt.Println(err)
+	err := q.store.DeleteURL(context.Background(), q.tasks)
+	if q.observer != nil {
+		q.observer.DeleteBatch(len(q.tasks), err)
+	}
+	if err != nil {
 		return err
 	}
 
 	q.logger.Info(fmt.Sprintf("Successfully did %d delete url tasks", len(q.tasks)))
 	q.tasks = q.tasks[:0]
+	q.observeDepth()
 	return nil
 }
+
+// observeDepth сообщает наблюдателю число задач в массиве и в канале.
+func (q *DeleteURLQueue) observeDepth() {
+	if q.observer != nil {
+		q.observer.QueueDepth(len(q.tasks) + len(q.ch))
+	}
+}
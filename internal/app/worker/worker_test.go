@@ -0,0 +1,212 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlexCorn999/short-url-service/internal/app/memorystorage"
+	"github.com/AlexCorn999/short-url-service/internal/app/store"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger() *log.Logger {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestDeleteURLQueueDrainsOnCancel(t *testing.T) {
+	db := memorystorage.NewMemoryStorage()
+	for _, code := range []string{"a", "b", "c"} {
+		require.NoError(t, db.WriteURL(context.Background(), store.NewURL(code, "http://"+code+".ru", 1)))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := NewDeleteURLQueue(db, newTestLogger(), 5)
+	q.Start(ctx)
+
+	q.Push(store.NewTask("a", 1))
+	q.Push(store.NewTask("b", 1))
+	cancel()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	require.NoError(t, q.Wait(waitCtx))
+
+	var url store.URL
+	assert.ErrorIs(t, db.ReadURL(context.Background(), &url, "a"), store.ErrDeleted)
+	assert.ErrorIs(t, db.ReadURL(context.Background(), &url, "b"), store.ErrDeleted)
+	assert.NoError(t, db.ReadURL(context.Background(), &url, "c"))
+}
+
+func TestDeleteURLQueueInterval(t *testing.T) {
+	db := memorystorage.NewMemoryStorage()
+	require.NoError(t, db.WriteURL(context.Background(), store.NewURL("a", "http://a.ru", 1)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := NewDeleteURLQueue(db, newTestLogger(), 5)
+	q.SetInterval(10 * time.Millisecond)
+	q.Start(ctx)
+	q.Push(store.NewTask("a", 1))
+
+	// задача удаляется по таймеру, без остановки очереди
+	assert.Eventually(t, func() bool {
+		var url store.URL
+		return errors.Is(db.ReadURL(context.Background(), &url, "a"), store.ErrDeleted)
+	}, time.Second, 10*time.Millisecond)
+}
+
+// deleteObserver запоминает сведения очереди удаления.
+type deleteObserver struct {
+	depths  []int
+	batches []int
+}
+
+func (o *deleteObserver) QueueDepth(n int) { o.depths = append(o.depths, n) }
+
+func (o *deleteObserver) DeleteBatch(size int, err error) { o.batches = append(o.batches, size) }
+
+func TestDeleteURLQueueObserver(t *testing.T) {
+	db := memorystorage.NewMemoryStorage()
+	require.NoError(t, db.WriteURL(context.Background(), store.NewURL("a", "http://a.ru", 1)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := NewDeleteURLQueue(db, newTestLogger(), 5)
+	observer := &deleteObserver{}
+	q.SetObserver(observer)
+	q.Start(ctx)
+
+	q.Push(store.NewTask("a", 1))
+	cancel()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	require.NoError(t, q.Wait(waitCtx))
+
+	assert.Equal(t, []int{1}, observer.batches)
+	require.NotEmpty(t, observer.depths)
+	assert.Equal(t, 0, observer.depths[len(observer.depths)-1])
+}
+
+func TestDeleteURLQueueWaitDeadline(t *testing.T) {
+	q := NewDeleteURLQueue(memorystorage.NewMemoryStorage(), newTestLogger(), 5)
+	q.Start(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, q.Wait(ctx), context.DeadlineExceeded)
+}
+
+func TestClickQueueDrainsOnCancel(t *testing.T) {
+	db := memorystorage.NewMemoryStorage()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := NewClickQueue(db, newTestLogger(), 10)
+	q.Start(ctx)
+
+	q.Push(store.Click{Code: "a", Time: time.Now(), IPHash: "x"})
+	q.Push(store.Click{Code: "a", Time: time.Now(), IPHash: "y"})
+	cancel()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	require.NoError(t, q.Wait(waitCtx))
+
+	stats, err := db.ClickStats(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.TotalClicks)
+}
+
+// failingAnalytics не сохраняет переходы и запоминает размеры пачек.
+type failingAnalytics struct {
+	mu      sync.Mutex
+	batches []int
+}
+
+func (a *failingAnalytics) WriteClicks(ctx context.Context, clicks []store.Click) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.batches = append(a.batches, len(clicks))
+	return errors.New("storage is down")
+}
+
+func (a *failingAnalytics) ClickStats(ctx context.Context, code string) (store.ClickStats, error) {
+	return store.ClickStats{}, nil
+}
+
+func TestClickQueueDropsFailedBatch(t *testing.T) {
+	db := &failingAnalytics{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := NewClickQueue(db, newTestLogger(), 2)
+	q.SetInterval(time.Hour)
+	q.Start(ctx)
+
+	// каждая пачка сохраняется по заполнении, несмотря на ошибки предыдущих
+	for i := 0; i < 6; i++ {
+		q.ch <- store.Click{Code: "a", Time: time.Now()}
+	}
+	require.Eventually(t, func() bool {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		return len(db.batches) == 3
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	require.NoError(t, q.Wait(waitCtx))
+
+	// неудачные пачки не накапливаются
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	assert.Equal(t, []int{2, 2, 2}, db.batches)
+}
+
+// rateLimits запоминает, с каким сроком удалялись корзины.
+type rateLimits struct {
+	idle []time.Duration
+}
+
+func (l *rateLimits) DeleteIdleRateLimits(ctx context.Context, idle time.Duration) (int, error) {
+	l.idle = append(l.idle, idle)
+	return 1, nil
+}
+
+func TestExpiredURLReaperRateLimits(t *testing.T) {
+	db := memorystorage.NewMemoryStorage()
+	expired := store.NewURL("old", "http://old.ru", 1)
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	require.NoError(t, db.WriteURL(context.Background(), expired))
+
+	limits := &rateLimits{}
+	r := NewExpiredURLReaper(db, newTestLogger(), time.Minute)
+	r.SetRateLimits(limits, time.Hour)
+	require.NoError(t, r.doReap(context.Background()))
+
+	var url store.URL
+	assert.ErrorIs(t, db.ReadURL(context.Background(), &url, "old"), store.ErrDeleted)
+	assert.Equal(t, []time.Duration{time.Hour}, limits.idle)
+}
+
+func TestExpiredURLReaperWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewExpiredURLReaper(memorystorage.NewMemoryStorage(), newTestLogger(), time.Minute)
+	r.Start(ctx)
+
+	deadline, deadlineCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer deadlineCancel()
+	assert.ErrorIs(t, r.Wait(deadline), context.DeadlineExceeded)
+
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	assert.NoError(t, r.Wait(waitCtx))
+}
@@ -0,0 +1,33 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+ALTER TABLE url ADD COLUMN code VARCHAR(64);
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+UPDATE url SET code = id::text;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+ALTER TABLE url ALTER COLUMN code SET NOT NULL;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+ALTER TABLE url ADD CONSTRAINT url_code_key UNIQUE (code);
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+ALTER TABLE url DROP COLUMN IF EXISTS code;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+ALTER TABLE url ADD COLUMN expires_at TIMESTAMPTZ;
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+ALTER TABLE url DROP COLUMN IF EXISTS expires_at;
+
+-- +goose StatementEnd
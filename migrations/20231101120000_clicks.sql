@@ -0,0 +1,29 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+CREATE TABLE
+    clicks (
+        id BIGSERIAL PRIMARY KEY,
+        code VARCHAR(64) NOT NULL,
+        clicked_at TIMESTAMPTZ NOT NULL,
+        referrer TEXT NOT NULL,
+        user_agent TEXT NOT NULL,
+        ip_hash VARCHAR(64) NOT NULL
+    );
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+CREATE INDEX clicks_code_idx ON clicks (code, clicked_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS clicks;
+
+-- +goose StatementEnd
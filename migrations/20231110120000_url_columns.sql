@@ -0,0 +1,58 @@
+-- +goose Up
+
+-- Раньше в shorturl хранился исходный url, а в originalurl — сокращённая
+-- ссылка вместе с базовым адресом. Код ссылки уже лежит в столбце code
+-- (для старых строк он равен id, которым заканчивается ссылка),
+-- поэтому ссылку можно удалить без потери данных.
+
+-- +goose StatementBegin
+
+ALTER TABLE url RENAME COLUMN shorturl TO original_url;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+ALTER TABLE url RENAME CONSTRAINT url_shorturl_key TO url_original_url_key;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+ALTER TABLE url DROP COLUMN originalurl;
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- Базовый адрес не сохранялся, поэтому в originalurl восстанавливается только код.
+
+-- +goose StatementBegin
+
+ALTER TABLE url ADD COLUMN originalurl VARCHAR(255);
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+UPDATE url SET originalurl = code;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+ALTER TABLE url ALTER COLUMN originalurl SET NOT NULL;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+ALTER TABLE url RENAME CONSTRAINT url_original_url_key TO url_shorturl_key;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+ALTER TABLE url RENAME COLUMN original_url TO shorturl;
+
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+
+-- Идентификаторы пользователей раньше выдавались счётчиком в памяти,
+-- поэтому последовательность начинается после уже выданных.
+
+-- +goose StatementBegin
+
+CREATE SEQUENCE user_id_seq;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+SELECT setval('user_id_seq', coalesce((SELECT max(user_id) FROM url), 0) + 1, false);
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP SEQUENCE user_id_seq;
+
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY,
+	login VARCHAR(64) NOT NULL,
+	password_hash TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	CONSTRAINT users_login_key UNIQUE (login)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP TABLE users;
+
+-- +goose StatementEnd
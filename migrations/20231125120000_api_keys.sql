@@ -0,0 +1,29 @@
+-- +goose Up
+
+-- +goose StatementBegin
+
+CREATE TABLE api_keys (
+	id VARCHAR(32) PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	key_hash VARCHAR(64) NOT NULL,
+	scopes TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	CONSTRAINT api_keys_key_hash_key UNIQUE (key_hash)
+);
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP TABLE api_keys;
+
+-- +goose StatementEnd
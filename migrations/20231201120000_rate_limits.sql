@@ -0,0 +1,21 @@
+-- +goose Up
+
+-- Корзины токенов общего ограничителя частоты запросов.
+
+-- +goose StatementBegin
+
+CREATE TABLE rate_limits (
+	key TEXT PRIMARY KEY,
+	tokens DOUBLE PRECISION NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP TABLE rate_limits;
+
+-- +goose StatementEnd
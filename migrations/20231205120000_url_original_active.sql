@@ -0,0 +1,32 @@
+-- +goose Up
+
+-- Исходный url уникален только среди неудалённых строк, чтобы удалённый
+-- или истёкший url можно было сократить заново.
+
+-- +goose StatementBegin
+
+ALTER TABLE url DROP CONSTRAINT url_original_url_key;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+CREATE UNIQUE INDEX url_original_url_active ON url (original_url) WHERE NOT deleted_flag;
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- Откат невозможен, если удалённый url уже сокращён заново.
+
+-- +goose StatementBegin
+
+DROP INDEX url_original_url_active;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+ALTER TABLE url ADD CONSTRAINT url_original_url_key UNIQUE (original_url);
+
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- Индекс для удаления давно не менявшихся корзин.
+
+-- +goose StatementBegin
+
+CREATE INDEX rate_limits_updated_at ON rate_limits (updated_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP INDEX rate_limits_updated_at;
+
+-- +goose StatementEnd
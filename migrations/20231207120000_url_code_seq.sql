@@ -0,0 +1,25 @@
+-- +goose Up
+
+-- Номера кодов раньше выдавались счётчиком в памяти, который после перезапуска
+-- начинался заново и пропускал занятые коды. Последовательность начинается
+-- после количества уже сохранённых url, оставшиеся занятые коды генератор пропускает.
+
+-- +goose StatementBegin
+
+CREATE SEQUENCE url_code_seq;
+
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+
+SELECT setval('url_code_seq', (SELECT count(*) FROM url) + 1, false);
+
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+
+DROP SEQUENCE url_code_seq;
+
+-- +goose StatementEnd
@@ -0,0 +1,8 @@
+// Package migrations встраивает миграции goose в бинарный файл,
+// чтобы они не зависели от рабочей директории.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS